@@ -1,8 +0,0 @@
-package beneficiary_ownership
-
-import models "lexicon/bo-api/beneficiary_ownership/v1/models"
-
-// 'in memory' fake database, so to speak
-
-var search_results []models.SearchResultModel
-var detail_results []models.DetailResultModel
@@ -0,0 +1,324 @@
+package bo_v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+	bo_v1_services "lexicon/bo-api/beneficiary_ownership/v1/services"
+	"lexicon/bo-api/common/utils"
+	"lexicon/bo-api/middlewares"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+// AdminRouter serves the curation and api client endpoints to clients with
+// the admin scope. Keys are issued hashed with salt, a revoked key is
+// forgotten by keys.
+func AdminRouter(cases *bo_v1_services.CaseService, keys *bo_v1_services.ApiKeyStore, salt string) *chi.Mux {
+	h := caseHandlers{cases: cases}
+
+	r := chi.NewMux()
+	r.Use(middleware.Timeout(requestTimeout))
+	r.Use(middlewares.RequireScope(models.ScopeAdmin))
+	r.Get("/cases", h.adminCasesHandler)
+	r.Post("/cases", h.adminCreateCaseHandler)
+	r.Post("/cases:bulk", h.adminImportCasesHandler)
+	r.Get("/cases/{id}", h.adminCaseHandler)
+	r.Put("/cases/{id}", h.adminUpdateCaseHandler)
+	r.Get("/cases/{id}/history", h.caseHistoryHandler(true))
+	r.Delete("/cases/{id}", adminCaseTransitionHandler(cases.DeleteCase))
+	r.Post("/cases/{id}/validate", adminCaseTransitionHandler(cases.ValidateCase))
+	r.Post("/cases/{id}/restore", adminCaseTransitionHandler(cases.RestoreCase))
+	r.Get("/clients", adminApiClientsHandler)
+	r.Post("/clients", adminIssueApiClientHandler(salt))
+	r.Get("/clients/{id}", adminApiClientHandler)
+	r.Post("/clients/{id}/revoke", adminRevokeApiClientHandler(keys))
+	return r
+}
+
+// writeCaseError maps the errors of a case write to a response.
+func writeCaseError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
+	case errors.Is(err, models.ErrCaseConflict):
+		utils.WriteError(w, http.StatusConflict, err)
+	case errors.Is(err, models.ErrCaseTransition):
+		utils.WriteError(w, http.StatusUnprocessableEntity, err)
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func (h caseHandlers) adminCasesHandler(w http.ResponseWriter, r *http.Request) {
+	qp := r.URL.Query()
+
+	status := qp.Get("status")
+	if status == "" {
+		status = "draft"
+	}
+
+	if !models.IsCaseStatus(status) {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("status must be one of validated, draft, deleted"))
+		return
+	}
+
+	page := 1
+	perPage := models.DefaultSearchPerPage
+
+	if rawPage := qp.Get("page"); rawPage != "" {
+		var err error
+		page, err = strconv.Atoi(rawPage)
+
+		if err != nil || page < 1 {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("page must be a number"))
+			return
+		}
+	}
+
+	if rawPerPage := qp.Get("per_page"); rawPerPage != "" {
+		var err error
+		perPage, err = strconv.Atoi(rawPerPage)
+
+		if err != nil || perPage < 1 || perPage > models.MaxSearchPerPage {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("per_page must be a number between 1 and %d", models.MaxSearchPerPage))
+			return
+		}
+	}
+
+	response, err := h.cases.GetCases(r.Context(), status, int64(page), int64(perPage))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteResponse(w, response, http.StatusOK)
+}
+
+func (h caseHandlers) adminCaseHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	response, err := h.cases.GetCase(r.Context(), id)
+	if err != nil {
+		writeCaseError(w, err)
+		return
+	}
+
+	utils.WriteData(w, response, http.StatusOK)
+}
+
+func (h caseHandlers) adminCreateCaseHandler(w http.ResponseWriter, r *http.Request) {
+	req := models.CaseFields{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding request body")
+		utils.WriteError(w, http.StatusBadRequest, errors.New("body is empty"))
+		return
+	}
+	defer r.Body.Close()
+
+	if err = req.Validate(); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response, err := h.cases.CreateCase(r.Context(), callerIdentity(r), req)
+	if err != nil {
+		writeCaseError(w, err)
+		return
+	}
+
+	utils.WriteData(w, response, http.StatusCreated)
+}
+
+func (h caseHandlers) adminUpdateCaseHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	req := models.CaseRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding request body")
+		utils.WriteError(w, http.StatusBadRequest, errors.New("body is empty"))
+		return
+	}
+	defer r.Body.Close()
+
+	if err = req.Validate(); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response, err := h.cases.UpdateCase(r.Context(), callerIdentity(r), id, req)
+	if err != nil {
+		writeCaseError(w, err)
+		return
+	}
+
+	utils.WriteData(w, response, http.StatusOK)
+}
+
+// maxCaseImportBytes bounds the body of a bulk import.
+const maxCaseImportBytes = 64 << 20
+
+// adminImportCasesHandler upserts a batch of cases as drafts. The format is
+// taken from the format query parameter or else from the content type.
+func (h caseHandlers) adminImportCasesHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+
+	if format == "" {
+		switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+		case "text/csv":
+			format = models.CaseImportCSV
+		case "application/x-ndjson", "application/ndjson", "application/jsonl":
+			format = models.CaseImportNDJSON
+		}
+	}
+
+	if format != models.CaseImportCSV && format != models.CaseImportNDJSON {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("format must be one of csv, ndjson"))
+		return
+	}
+
+	defer r.Body.Close()
+
+	records, err := models.DecodeCaseRecords(http.MaxBytesReader(w, r.Body, maxCaseImportBytes), format)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(records) == 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("body is empty"))
+		return
+	}
+
+	if len(records) > models.MaxCaseImportRows {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("an import can not have more than %d rows", models.MaxCaseImportRows))
+		return
+	}
+
+	response, err := h.cases.ImportCases(r.Context(), callerIdentity(r), records)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteData(w, response, http.StatusOK)
+}
+
+// adminCaseTransitionHandler serves a status change, the body carries the
+// updated_at of the case as it was read.
+func adminCaseTransitionHandler(transition func(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		req := models.CaseTransitionRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			log.Error().Err(err).Msg("Error decoding request body")
+			utils.WriteError(w, http.StatusBadRequest, errors.New("body is empty"))
+			return
+		}
+		defer r.Body.Close()
+
+		if !req.UpdatedAt.Valid {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("updated_at is required"))
+			return
+		}
+
+		response, err := transition(r.Context(), callerIdentity(r), id, req.UpdatedAt)
+		if err != nil {
+			writeCaseError(w, err)
+			return
+		}
+
+		utils.WriteData(w, response, http.StatusOK)
+	}
+}
+
+func adminApiClientsHandler(w http.ResponseWriter, r *http.Request) {
+	response, err := bo_v1_services.GetApiClients(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteData(w, response, http.StatusOK)
+}
+
+// adminIssueApiClientHandler registers a client, the response holds its key
+// and is the only one that does.
+func adminIssueApiClientHandler(salt string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := models.ApiClientRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			log.Error().Err(err).Msg("Error decoding request body")
+			utils.WriteError(w, http.StatusBadRequest, errors.New("body is empty"))
+			return
+		}
+		defer r.Body.Close()
+
+		if err = req.Validate(); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		response, err := bo_v1_services.IssueApiClient(r.Context(), salt, req)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		log.Info().Msgf("Api client %s issued by %s", response.ID, callerIdentity(r))
+
+		utils.WriteData(w, response, http.StatusCreated)
+	}
+}
+
+func adminApiClientHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	response, err := bo_v1_services.GetApiClient(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
+		return
+	}
+
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteData(w, response, http.StatusOK)
+}
+
+func adminRevokeApiClientHandler(keys *bo_v1_services.ApiKeyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		response, err := keys.RevokeApiClient(r.Context(), id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
+			return
+		}
+
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		log.Info().Msgf("Api client %s revoked by %s", response.ID, callerIdentity(r))
+
+		utils.WriteData(w, response, http.StatusOK)
+	}
+}
@@ -0,0 +1,73 @@
+package bo_v1_models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+// materialized views of the charts, refreshed together
+const (
+	caseStats     = "case_stats"
+	lkppCaseStats = "lkpp_case_stats"
+)
+
+var aggregates = []string{caseStats, lkppCaseStats}
+
+// RefreshAggregates recomputes the materialized views of the charts and
+// records when. The charts keep reading the previous rows until the
+// transaction commits.
+func RefreshAggregates(ctx context.Context, tx pgx.Tx) (null.Time, error) {
+	for _, name := range aggregates {
+		q := "REFRESH MATERIALIZED VIEW CONCURRENTLY " + name
+
+		log.Info().Msg("Executing query: " + q)
+
+		if _, err := tx.Exec(ctx, q); err != nil {
+			log.Error().Err(err).Msg("Error refreshing " + name)
+			return null.Time{}, err
+		}
+	}
+
+	q := `
+		UPDATE
+			aggregate_refreshes
+		SET
+			refreshed_at = now()
+		WHERE
+			name = ANY($1)
+		RETURNING
+			refreshed_at
+	`
+
+	log.Info().Msg("Executing query: " + q)
+
+	var refreshedAt null.Time
+
+	err := tx.QueryRow(ctx, q, aggregates).Scan(&refreshedAt)
+	if err != nil {
+		log.Error().Err(err).Msg("Error recording aggregate refresh")
+		return null.Time{}, err
+	}
+
+	return refreshedAt, nil
+}
+
+// aggregateRefreshedAt is when the view name was last refreshed.
+func aggregateRefreshedAt(ctx context.Context, tx pgx.Tx, name string) (null.Time, error) {
+	q := `SELECT refreshed_at FROM aggregate_refreshes WHERE name = $1`
+
+	log.Info().Msg("Executing query: " + q)
+
+	var refreshedAt null.Time
+
+	err := tx.QueryRow(ctx, q, name).Scan(&refreshedAt)
+	if err != nil {
+		log.Error().Err(err).Msg("Error querying aggregate refresh")
+		return null.Time{}, err
+	}
+
+	return refreshedAt, nil
+}
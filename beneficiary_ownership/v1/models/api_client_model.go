@@ -0,0 +1,188 @@
+package bo_v1_models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+// scopes an API client can be granted, each guards a group of routes
+const (
+	ScopeSearch     = "search"
+	ScopeDetail     = "detail"
+	ScopeScreening  = "screening"
+	ScopeWatchlists = "watchlists"
+	ScopeChatbot    = "chatbot"
+	ScopeAdmin      = "admin"
+)
+
+// PublicScopes are every scope but admin.
+var PublicScopes = []string{ScopeSearch, ScopeDetail, ScopeScreening, ScopeWatchlists, ScopeChatbot}
+
+// IsApiScope reports whether s names a scope.
+func IsApiScope(s string) bool {
+	return s == ScopeAdmin || slices.Contains(PublicScopes, s)
+}
+
+// apiKeyPrefixLength is how much of a key is kept in the clear, to tell keys
+// apart in listings.
+const apiKeyPrefixLength = 10
+
+// ApiClientRequest is the body of a key issue.
+type ApiClientRequest struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt null.Time `json:"expires_at"`
+}
+
+// Validate checks the request before a key is issued.
+func (a ApiClientRequest) Validate() error {
+	if a.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if len(a.Scopes) == 0 {
+		return errors.New("scopes is required")
+	}
+
+	for _, scope := range a.Scopes {
+		if !IsApiScope(scope) {
+			return errors.New("scopes must be a list of search, detail, screening, watchlists, chatbot, admin")
+		}
+	}
+
+	if a.ExpiresAt.Valid && !a.ExpiresAt.Time.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+
+	return nil
+}
+
+// ApiClientModel is a consumer of the API, its key is never served back.
+type ApiClientModel struct {
+	ID        ulid.ULID `json:"id"`
+	Name      string    `json:"name"`
+	KeyPrefix string    `json:"key_prefix"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt null.Time `json:"expires_at"`
+	Revoked   bool      `json:"revoked"`
+	RevokedAt null.Time `json:"revoked_at"`
+	CreatedAt null.Time `json:"created_at"`
+}
+
+// ApiKeySecret is an issued key, it prints redacted so it stays out of the
+// logs.
+type ApiKeySecret string
+
+func (k ApiKeySecret) String() string {
+	return "[redacted]"
+}
+
+// IssuedApiClientModel is a client as it is issued, the only time its key is
+// shown.
+type IssuedApiClientModel struct {
+	ApiClientModel
+	Key ApiKeySecret `json:"key"`
+}
+
+var emptyApiClient ApiClientModel
+
+const apiClientColumns = `id, name, key_prefix, scopes, expires_at, revoked, revoked_at, created_at`
+
+func scanApiClient(row pgx.Row) (ApiClientModel, error) {
+	var c ApiClientModel
+
+	err := row.Scan(&c.ID, &c.Name, &c.KeyPrefix, &c.Scopes, &c.ExpiresAt, &c.Revoked, &c.RevokedAt, &c.CreatedAt)
+	if err != nil {
+		return emptyApiClient, err
+	}
+
+	return c, nil
+}
+
+// NewApiKey generates a random key for a client.
+func NewApiKey() (string, error) {
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return "bo_" + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// CreateApiClient stores a client with the hash of its key.
+func CreateApiClient(ctx context.Context, tx pgx.Tx, apiClientRequest ApiClientRequest, key string, keyHash string) (ApiClientModel, error) {
+	query := `
+	INSERT INTO api_clients (id, name, key_hash, key_prefix, scopes, expires_at, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, now())
+	RETURNING ` + apiClientColumns
+
+	log.Info().Msg("Executing query: " + query)
+
+	scopes := slices.Clone(apiClientRequest.Scopes)
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	return scanApiClient(tx.QueryRow(ctx, query, ulid.Make().String(), apiClientRequest.Name, keyHash, key[:apiKeyPrefixLength], scopes, apiClientRequest.ExpiresAt))
+}
+
+// GetApiClients lists every client, the most recently issued first.
+func GetApiClients(ctx context.Context, tx pgx.Tx) ([]ApiClientModel, error) {
+	query := `SELECT ` + apiClientColumns + ` FROM api_clients ORDER BY created_at DESC, id DESC`
+
+	log.Info().Msg("Executing query: " + query)
+
+	rows, err := tx.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (ApiClientModel, error) {
+		return scanApiClient(row)
+	})
+}
+
+func GetApiClientById(ctx context.Context, tx pgx.Tx, id string) (ApiClientModel, error) {
+	query := `SELECT ` + apiClientColumns + ` FROM api_clients WHERE id = $1`
+
+	log.Info().Msg("Executing query: " + query)
+
+	return scanApiClient(tx.QueryRow(ctx, query, id))
+}
+
+// RevokeApiClient disables the key of a client for good, revoking it again
+// keeps the time of the first revocation.
+func RevokeApiClient(ctx context.Context, tx pgx.Tx, id string) (ApiClientModel, error) {
+	query := `
+	UPDATE api_clients
+	SET revoked = true, revoked_at = COALESCE(revoked_at, now())
+	WHERE id = $1
+	RETURNING ` + apiClientColumns
+
+	log.Info().Msg("Executing query: " + query)
+
+	return scanApiClient(tx.QueryRow(ctx, query, id))
+}
+
+// GetActiveApiClientByKeyHash returns the client of a key unless it is
+// revoked or expired.
+func GetActiveApiClientByKeyHash(ctx context.Context, tx pgx.Tx, keyHash string) (ApiClientModel, error) {
+	query := `
+	SELECT ` + apiClientColumns + `
+	FROM api_clients
+	WHERE key_hash = $1
+	AND NOT revoked
+	AND (expires_at IS NULL OR expires_at > now())
+	`
+
+	return scanApiClient(tx.QueryRow(ctx, query, keyHash))
+}
@@ -0,0 +1,322 @@
+package bo_v1_models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+
+	commonModels "lexicon/bo-api/common/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+var (
+	// ErrCaseConflict is returned when the updated_at sent with a write no
+	// longer matches the case, someone else changed it in between.
+	ErrCaseConflict = errors.New("case was changed since it was read, reload it and try again")
+	// ErrCaseTransition is returned when the case is not in a status the
+	// requested change can be made from.
+	ErrCaseTransition = errors.New("case status does not allow this change")
+
+	caseYear = regexp.MustCompile(`^\d{4}$`)
+)
+
+// CaseFields are the columns of a case curators can edit.
+type CaseFields struct {
+	Subject              string          `json:"subject"`
+	SubjectType          string          `json:"subject_type"`
+	PersonInCharge       null.String     `json:"person_in_charge"`
+	BenificiaryOwnership null.String     `json:"benificiary_ownership"`
+	CaseDate             null.Time       `json:"case_date"`
+	DecisionNumber       null.String     `json:"decision_number"`
+	Source               string          `json:"source"`
+	Link                 string          `json:"link"`
+	Nation               string          `json:"nation"`
+	PunishmentStart      null.Time       `json:"punishment_start"`
+	PunishmentEnd        null.Time       `json:"punishment_end"`
+	Type                 string          `json:"type"`
+	Year                 string          `json:"year"`
+	Summary              string          `json:"summary"`
+	ExtraData            json.RawMessage `json:"extra_data"`
+}
+
+// Validate checks the fields before they are stored.
+func (c CaseFields) Validate() error {
+	if c.Subject == "" {
+		return errors.New("subject is required")
+	}
+
+	if newSubjectType(c.SubjectType) == 0 {
+		return errors.New("subject_type must be one of individual, company, organization")
+	}
+
+	if newCaseType(c.Type) == 0 {
+		return errors.New("type must be one of verdict, blacklist, sanction")
+	}
+
+	if c.Source == "" {
+		return errors.New("source is required")
+	}
+
+	if c.Nation == "" {
+		return errors.New("nation is required")
+	}
+
+	if !caseYear.MatchString(c.Year) {
+		return errors.New("year must be a four digit year")
+	}
+
+	if c.Link != "" {
+		link, err := url.Parse(c.Link)
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+			return errors.New("link must be an http or https url")
+		}
+	}
+
+	if c.PunishmentStart.Valid && c.PunishmentEnd.Valid && c.PunishmentEnd.Time.Before(c.PunishmentStart.Time) {
+		return errors.New("punishment_end must not be before punishment_start")
+	}
+
+	if len(c.ExtraData) > 0 {
+		if _, err := ParseExtraData(c.ExtraData); err != nil {
+			return errors.New("extra_data must be a list of entries with a type and data")
+		}
+	}
+
+	return nil
+}
+
+// CaseRequest is the body of a case edit, UpdatedAt is the updated_at of the
+// case as it was read and is required.
+type CaseRequest struct {
+	CaseFields
+	UpdatedAt null.Time `json:"updated_at"`
+}
+
+func (c CaseRequest) Validate() error {
+	if !c.UpdatedAt.Valid {
+		return errors.New("updated_at is required")
+	}
+
+	return c.CaseFields.Validate()
+}
+
+// CaseTransitionRequest is the body of a status change.
+type CaseTransitionRequest struct {
+	UpdatedAt null.Time `json:"updated_at"`
+}
+
+// CaseModel is a case of any status as curators see it.
+type CaseModel struct {
+	ID ulid.ULID `json:"id"`
+	CaseFields
+	Status    string    `json:"status"`
+	CreatedAt null.Time `json:"created_at"`
+	UpdatedAt null.Time `json:"updated_at"`
+}
+
+var emptyCase CaseModel
+
+const caseColumns = `id, subject, subject_type, person_in_charge, benificiary_ownership, case_date, decision_number, source, link, nation, punishment_start, punishment_end, case_type, year, summary, extra_data, status, created_at, updated_at`
+
+func scanCase(row pgx.Row) (CaseModel, error) {
+	var c CaseModel
+	var subjectType SubjectTypeInt
+	var caseType CaseType
+	var status CaseStatus
+
+	err := row.Scan(&c.ID, &c.Subject, &subjectType, &c.PersonInCharge, &c.BenificiaryOwnership, &c.CaseDate, &c.DecisionNumber, &c.Source, &c.Link, &c.Nation, &c.PunishmentStart, &c.PunishmentEnd, &caseType, &c.Year, &c.Summary, &c.ExtraData, &status, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return emptyCase, err
+	}
+
+	c.SubjectType = subjectType.String()
+	c.Type = caseType.String()
+	c.Status = status.String()
+
+	return c, nil
+}
+
+// GetCaseById returns a case whatever its status.
+func GetCaseById(ctx context.Context, tx pgx.Tx, id string) (CaseModel, error) {
+	query := `SELECT ` + caseColumns + ` FROM cases WHERE id = $1`
+
+	log.Info().Msg("Executing query: " + query)
+
+	return scanCase(tx.QueryRow(ctx, query, id))
+}
+
+// GetCases lists the cases of a status, the most recently changed first.
+func GetCases(ctx context.Context, tx pgx.Tx, status string, page int64, perPage int64) (commonModels.BasePaginationResponse, error) {
+	caseStatus, ok := newCaseStatus(status)
+	if !ok {
+		caseStatus = draft
+	}
+
+	var total int64
+
+	err := tx.QueryRow(ctx, `SELECT count(*) FROM cases WHERE status = $1`, caseStatus).Scan(&total)
+	if err != nil {
+		return commonModels.BasePaginationResponse{}, err
+	}
+
+	query := `SELECT ` + caseColumns + ` FROM cases WHERE status = $1 ORDER BY updated_at DESC, id ASC LIMIT $2 OFFSET $3`
+
+	log.Info().Msg("Executing query: " + query)
+
+	rows, err := tx.Query(ctx, query, caseStatus, perPage, (page-1)*perPage)
+	if err != nil {
+		return commonModels.BasePaginationResponse{}, err
+	}
+
+	cases, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (CaseModel, error) {
+		return scanCase(row)
+	})
+	if err != nil {
+		return commonModels.BasePaginationResponse{}, err
+	}
+
+	return commonModels.BasePaginationResponse{
+		Data: cases,
+		Meta: commonModels.MetaResponse{
+			CurrentPage: page,
+			LastPage:    int64(math.Ceil(float64(total) / float64(perPage))),
+			PerPage:     perPage,
+			Total:       total,
+		},
+	}, nil
+}
+
+// CreateCase stores a new case as a draft.
+func CreateCase(ctx context.Context, tx pgx.Tx, actor string, fields CaseFields) (CaseModel, error) {
+	query := `
+	INSERT INTO cases (id, subject, subject_type, person_in_charge, benificiary_ownership, case_date, decision_number, source, link, nation, punishment_start, punishment_end, case_type, year, summary, extra_data, status, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, now(), now())
+	RETURNING ` + caseColumns
+
+	log.Info().Msg("Executing query: " + query)
+
+	row := tx.QueryRow(ctx, query, ulid.Make().String(), fields.Subject, newSubjectType(fields.SubjectType), fields.PersonInCharge, fields.BenificiaryOwnership, fields.CaseDate, fields.DecisionNumber, fields.Source, fields.Link, fields.Nation, fields.PunishmentStart, fields.PunishmentEnd, newCaseType(fields.Type), fields.Year, fields.Summary, fields.ExtraData, draft)
+
+	created, err := scanCase(row)
+	if err != nil {
+		return emptyCase, err
+	}
+
+	if err = recordCaseRevision(ctx, tx, actor, CaseCreated, emptyCase, created); err != nil {
+		return emptyCase, err
+	}
+
+	return created, nil
+}
+
+// lockCase reads a case and locks it until the end of the transaction, so
+// the revision recorded for a write starts from the state it replaced.
+func lockCase(ctx context.Context, tx pgx.Tx, id string) (CaseModel, error) {
+	return scanCase(tx.QueryRow(ctx, `SELECT `+caseColumns+` FROM cases WHERE id = $1 FOR UPDATE`, id))
+}
+
+// UpdateCase replaces the fields of a draft or validated case, its status is
+// kept. The graph of a validated case is extracted again.
+func UpdateCase(ctx context.Context, tx pgx.Tx, actor string, id string, caseRequest CaseRequest) (CaseModel, error) {
+	fields := caseRequest.CaseFields
+
+	before, err := lockCase(ctx, tx, id)
+	if err != nil {
+		return emptyCase, err
+	}
+
+	query := `
+	UPDATE cases
+	SET subject = $4, subject_type = $5, person_in_charge = $6, benificiary_ownership = $7, case_date = $8, decision_number = $9, source = $10, link = $11, nation = $12,
+		punishment_start = $13, punishment_end = $14, case_type = $15, year = $16, summary = $17, extra_data = $18, updated_at = now()
+	WHERE id = $1
+	AND status = ANY($2::int[])
+	AND updated_at = $3
+	RETURNING ` + caseColumns
+
+	log.Info().Msg("Executing query: " + query)
+
+	allowed := pgtype.FlatArray[CaseStatus]{draft, validated}
+
+	row := tx.QueryRow(ctx, query, id, allowed, caseRequest.UpdatedAt, fields.Subject, newSubjectType(fields.SubjectType), fields.PersonInCharge, fields.BenificiaryOwnership, fields.CaseDate, fields.DecisionNumber, fields.Source, fields.Link, fields.Nation, fields.PunishmentStart, fields.PunishmentEnd, newCaseType(fields.Type), fields.Year, fields.Summary, fields.ExtraData)
+
+	return afterCaseWrite(ctx, tx, actor, CaseUpdated, before, allowed, row)
+}
+
+// ValidateCase publishes a draft.
+func ValidateCase(ctx context.Context, tx pgx.Tx, actor string, id string, updatedAt null.Time) (CaseModel, error) {
+	return transitionCase(ctx, tx, actor, CaseValidated, id, updatedAt, pgtype.FlatArray[CaseStatus]{draft}, validated)
+}
+
+// DeleteCase soft deletes a draft or validated case.
+func DeleteCase(ctx context.Context, tx pgx.Tx, actor string, id string, updatedAt null.Time) (CaseModel, error) {
+	return transitionCase(ctx, tx, actor, CaseDeleted, id, updatedAt, pgtype.FlatArray[CaseStatus]{draft, validated}, deleted)
+}
+
+// RestoreCase brings a deleted case back as a draft, it has to be validated
+// again before it is published.
+func RestoreCase(ctx context.Context, tx pgx.Tx, actor string, id string, updatedAt null.Time) (CaseModel, error) {
+	return transitionCase(ctx, tx, actor, CaseRestored, id, updatedAt, pgtype.FlatArray[CaseStatus]{deleted}, draft)
+}
+
+func transitionCase(ctx context.Context, tx pgx.Tx, actor string, action string, id string, updatedAt null.Time, from pgtype.FlatArray[CaseStatus], to CaseStatus) (CaseModel, error) {
+	before, err := lockCase(ctx, tx, id)
+	if err != nil {
+		return emptyCase, err
+	}
+
+	query := `
+	UPDATE cases
+	SET status = $4, updated_at = now()
+	WHERE id = $1
+	AND status = ANY($2::int[])
+	AND updated_at = $3
+	RETURNING ` + caseColumns
+
+	log.Info().Msg("Executing query: " + query)
+
+	row := tx.QueryRow(ctx, query, id, from, updatedAt, to)
+
+	return afterCaseWrite(ctx, tx, actor, action, before, from, row)
+}
+
+// afterCaseWrite reads the case returned by a conditional write. When nothing
+// was written it tells apart a case in another status and a stale updated_at.
+// A write is recorded as a revision and the graph of the case follows its new
+// state.
+func afterCaseWrite(ctx context.Context, tx pgx.Tx, actor string, action string, before CaseModel, allowed pgtype.FlatArray[CaseStatus], row pgx.Row) (CaseModel, error) {
+	written, err := scanCase(row)
+
+	if err == pgx.ErrNoRows {
+		status, _ := newCaseStatus(before.Status)
+
+		if !slices.Contains(allowed, status) {
+			return emptyCase, ErrCaseTransition
+		}
+
+		return emptyCase, ErrCaseConflict
+	}
+
+	if err != nil {
+		return emptyCase, err
+	}
+
+	if err = recordCaseRevision(ctx, tx, actor, action, before, written); err != nil {
+		return emptyCase, err
+	}
+
+	if err = SyncCaseGraph(ctx, tx, written.ID.String()); err != nil {
+		return emptyCase, err
+	}
+
+	return written, nil
+}
@@ -0,0 +1,331 @@
+package bo_v1_models
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	CaseImportCSV    = "csv"
+	CaseImportNDJSON = "ndjson"
+
+	// MaxCaseImportRows bounds a single import request, the CLI has no limit
+	MaxCaseImportRows = 20000
+)
+
+// outcomes of an imported row
+const (
+	CaseImportCreated   = "created"
+	CaseImportUpdated   = "updated"
+	CaseImportUnchanged = "unchanged"
+	CaseImportSkipped   = "skipped"
+	CaseImportInvalid   = "invalid"
+)
+
+// CaseImportResult is the outcome of one row of an import, rows are numbered
+// from 1 in the order they were sent.
+type CaseImportResult struct {
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CaseImportReport counts the outcomes of an import and lists every row.
+type CaseImportReport struct {
+	Created   int                `json:"created"`
+	Updated   int                `json:"updated"`
+	Unchanged int                `json:"unchanged"`
+	Skipped   int                `json:"skipped"`
+	Invalid   int                `json:"invalid"`
+	Rows      []CaseImportResult `json:"rows"`
+}
+
+func (r *CaseImportReport) add(result CaseImportResult) {
+	switch result.Status {
+	case CaseImportCreated:
+		r.Created++
+	case CaseImportUpdated:
+		r.Updated++
+	case CaseImportUnchanged:
+		r.Unchanged++
+	case CaseImportSkipped:
+		r.Skipped++
+	case CaseImportInvalid:
+		r.Invalid++
+	}
+
+	r.Rows = append(r.Rows, result)
+}
+
+// DecodeCaseRecords splits an import into one JSON object per row, either
+// from newline delimited JSON or from CSV with the JSON field names as
+// header. Rows are only decoded into cases by ImportCases, so a malformed
+// row is reported instead of failing the whole import.
+func DecodeCaseRecords(r io.Reader, format string) ([]json.RawMessage, error) {
+	switch format {
+	case CaseImportCSV:
+		return DecodeCaseCSV(r)
+	case CaseImportNDJSON:
+		var records []json.RawMessage
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			records = append(records, json.RawMessage(bytes.Clone(line)))
+		}
+
+		return records, scanner.Err()
+	default:
+		return nil, errors.New("format must be one of csv, ndjson")
+	}
+}
+
+// CaseImportRow is a valid row of an import, Row indexes the results.
+type CaseImportRow struct {
+	Row    int
+	Fields CaseFields
+}
+
+// ErrCaseImportDeleted is reported for a row matching a deleted case.
+var ErrCaseImportDeleted = errors.New("case is deleted, restore it before importing")
+
+func importKey(decisionNumber string, source string) string {
+	return strconv.Quote(decisionNumber) + strconv.Quote(source)
+}
+
+// ParseCaseImport validates the records of an import. It returns a result for
+// every record, already filled in for the invalid ones and the ones replaced
+// by a later row of the same decision, and the rows left to write keyed on
+// decision_number and source.
+func ParseCaseImport(records []json.RawMessage) ([]CaseImportResult, []CaseImportRow) {
+	results := make([]CaseImportResult, len(records))
+
+	byKey := map[string]int{}
+	var imported []CaseImportRow
+
+	for i, record := range records {
+		results[i] = CaseImportResult{Row: i + 1}
+
+		var fields CaseFields
+		err := json.Unmarshal(record, &fields)
+
+		if err == nil {
+			err = fields.Validate()
+		}
+
+		if err == nil && fields.DecisionNumber.String == "" {
+			err = errors.New("decision_number is required")
+		}
+
+		if err != nil {
+			results[i].Status = CaseImportInvalid
+			results[i].Error = err.Error()
+			continue
+		}
+
+		// the last row of a decision wins, an upsert can not touch a case twice
+		key := importKey(fields.DecisionNumber.String, fields.Source)
+		if previous, ok := byKey[key]; ok {
+			results[imported[previous].Row].Status = CaseImportSkipped
+			results[imported[previous].Row].Error = fmt.Sprintf("replaced by row %d", i+1)
+			imported[previous] = CaseImportRow{Row: i, Fields: fields}
+			continue
+		}
+
+		byKey[key] = len(imported)
+		imported = append(imported, CaseImportRow{Row: i, Fields: fields})
+	}
+
+	return results, imported
+}
+
+// NewCaseImportReport counts the results of an import.
+func NewCaseImportReport(results []CaseImportResult) CaseImportReport {
+	report := CaseImportReport{Rows: []CaseImportResult{}}
+
+	for _, result := range results {
+		report.add(result)
+	}
+
+	return report
+}
+
+// ImportCases validates the records and upserts them as drafts keyed on
+// decision_number and source. A case that already exists is updated and
+// goes back to draft for review, unless nothing changed or it was deleted.
+// A case stored without a decision_number is never matched by an import.
+// The rows are loaded with COPY into a temporary table and written with a
+// single upsert, every write is recorded as a revision.
+func ImportCases(ctx context.Context, tx pgx.Tx, actor string, records []json.RawMessage) (CaseImportReport, error) {
+	results, imported := ParseCaseImport(records)
+
+	if len(imported) > 0 {
+		if err := upsertImportedCases(ctx, tx, actor, imported, results); err != nil {
+			return CaseImportReport{}, err
+		}
+	}
+
+	report := NewCaseImportReport(results)
+
+	log.Info().Msgf("Imported %d rows, %d created, %d updated, %d unchanged, %d skipped, %d invalid", len(records), report.Created, report.Updated, report.Unchanged, report.Skipped, report.Invalid)
+
+	return report, nil
+}
+
+func upsertImportedCases(ctx context.Context, tx pgx.Tx, actor string, imported []CaseImportRow, results []CaseImportResult) error {
+	_, err := tx.Exec(ctx, `
+	CREATE TEMPORARY TABLE case_imports (
+		id text, subject text, subject_type integer, person_in_charge text, benificiary_ownership text, case_date date,
+		decision_number text, source text, link text, nation text, punishment_start date, punishment_end date,
+		case_type integer, year text, summary text, extra_data jsonb
+	) ON COMMIT DROP
+	`)
+	if err != nil {
+		return err
+	}
+
+	columns := []string{"id", "subject", "subject_type", "person_in_charge", "benificiary_ownership", "case_date", "decision_number", "source", "link", "nation", "punishment_start", "punishment_end", "case_type", "year", "summary", "extra_data"}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"case_imports"}, columns, pgx.CopyFromSlice(len(imported), func(i int) ([]any, error) {
+		c := imported[i].Fields
+		return []any{ulid.Make().String(), c.Subject, newSubjectType(c.SubjectType), c.PersonInCharge, c.BenificiaryOwnership, c.CaseDate, c.DecisionNumber, c.Source, c.Link, c.Nation, c.PunishmentStart, c.PunishmentEnd, newCaseType(c.Type), c.Year, c.Summary, c.ExtraData}, nil
+	}))
+	if err != nil {
+		return err
+	}
+
+	// the cases about to be replaced, locked so their revisions start from
+	// the state they had
+	rows, err := tx.Query(ctx, `SELECT `+caseColumns+` FROM cases WHERE (decision_number, source) IN (SELECT decision_number, source FROM case_imports) FOR UPDATE`)
+	if err != nil {
+		return err
+	}
+
+	existing, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (CaseModel, error) {
+		return scanCase(row)
+	})
+	if err != nil {
+		return err
+	}
+
+	before := map[string]CaseModel{}
+	for _, c := range existing {
+		before[importKey(c.DecisionNumber.String, c.Source)] = c
+	}
+
+	query := `
+	INSERT INTO cases (id, subject, subject_type, person_in_charge, benificiary_ownership, case_date, decision_number, source, link, nation, punishment_start, punishment_end, case_type, year, summary, extra_data, status, created_at, updated_at)
+	SELECT id, subject, subject_type, person_in_charge, benificiary_ownership, case_date, decision_number, source, link, nation, punishment_start, punishment_end, case_type, year, summary, extra_data, $1::integer, now(), now()
+	FROM case_imports
+	ON CONFLICT (decision_number, source) DO UPDATE SET
+		subject = EXCLUDED.subject, subject_type = EXCLUDED.subject_type, person_in_charge = EXCLUDED.person_in_charge,
+		benificiary_ownership = EXCLUDED.benificiary_ownership, case_date = EXCLUDED.case_date, link = EXCLUDED.link,
+		nation = EXCLUDED.nation, punishment_start = EXCLUDED.punishment_start, punishment_end = EXCLUDED.punishment_end,
+		case_type = EXCLUDED.case_type, year = EXCLUDED.year, summary = EXCLUDED.summary, extra_data = EXCLUDED.extra_data,
+		status = EXCLUDED.status, updated_at = now()
+	WHERE cases.status <> $2
+	AND (cases.subject, cases.subject_type, cases.person_in_charge, cases.benificiary_ownership, cases.case_date, cases.link,
+		cases.nation, cases.punishment_start, cases.punishment_end, cases.case_type, cases.year, cases.summary, cases.extra_data)
+	IS DISTINCT FROM (EXCLUDED.subject, EXCLUDED.subject_type, EXCLUDED.person_in_charge, EXCLUDED.benificiary_ownership, EXCLUDED.case_date, EXCLUDED.link,
+		EXCLUDED.nation, EXCLUDED.punishment_start, EXCLUDED.punishment_end, EXCLUDED.case_type, EXCLUDED.year, EXCLUDED.summary, EXCLUDED.extra_data)
+	RETURNING ` + caseColumns
+
+	log.Info().Msg("Executing query: " + query)
+
+	rows, err = tx.Query(ctx, query, draft, deleted)
+	if err != nil {
+		return err
+	}
+
+	written, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (CaseModel, error) {
+		return scanCase(row)
+	})
+	if err != nil {
+		return err
+	}
+
+	after := map[string]CaseModel{}
+	for _, c := range written {
+		after[importKey(c.DecisionNumber.String, c.Source)] = c
+	}
+
+	var revisions []caseRevision
+	var unpublished []string
+
+	for _, c := range imported {
+		key := importKey(c.Fields.DecisionNumber.String, c.Fields.Source)
+		result := &results[c.Row]
+		previous, existed := before[key]
+		current, changed := after[key]
+
+		switch {
+		case changed && !existed:
+			result.Status = CaseImportCreated
+			result.ID = current.ID.String()
+			revisions = append(revisions, caseRevision{action: CaseCreated, before: emptyCase, after: current})
+		case changed:
+			result.Status = CaseImportUpdated
+			result.ID = current.ID.String()
+			revisions = append(revisions, caseRevision{action: CaseUpdated, before: previous, after: current})
+			unpublished = append(unpublished, result.ID)
+		case previous.Status == deleted.String():
+			result.Status = CaseImportSkipped
+			result.ID = previous.ID.String()
+			result.Error = ErrCaseImportDeleted.Error()
+		default:
+			result.Status = CaseImportUnchanged
+			result.ID = previous.ID.String()
+		}
+	}
+
+	// updated cases are drafts again and leave the graph until validated
+	if len(unpublished) > 0 {
+		if _, err = tx.Exec(ctx, `DELETE FROM entity_relations WHERE case_id = ANY($1)`, unpublished); err != nil {
+			return err
+		}
+	}
+
+	return recordCaseRevisions(ctx, tx, actor, revisions)
+}
+
+type caseRevision struct {
+	action string
+	before CaseModel
+	after  CaseModel
+}
+
+// recordCaseRevisions appends many revisions at once with COPY.
+func recordCaseRevisions(ctx context.Context, tx pgx.Tx, actor string, revisions []caseRevision) error {
+	if len(revisions) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{"case_revisions"}, []string{"id", "case_id", "actor", "action", "changes", "created_at"}, pgx.CopyFromSlice(len(revisions), func(i int) ([]any, error) {
+		changes, err := DiffCases(revisions[i].before, revisions[i].after)
+		if err != nil {
+			return nil, err
+		}
+		return []any{ulid.Make().String(), revisions[i].after.ID.String(), actor, revisions[i].action, changes, now}, nil
+	}))
+
+	return err
+}
@@ -46,6 +46,25 @@ func (c CaseStatus) String() string {
 	return [...]string{"deleted", "validated", "draft"}[c]
 }
 
+func newCaseStatus(s string) (CaseStatus, bool) {
+	switch s {
+	case "deleted":
+		return deleted, true
+	case "validated":
+		return validated, true
+	case "draft":
+		return draft, true
+	default:
+		return 0, false
+	}
+}
+
+// IsCaseStatus reports whether s names a case status.
+func IsCaseStatus(s string) bool {
+	_, ok := newCaseStatus(s)
+	return ok
+}
+
 type SubjectTypeInt int
 
 const (
@@ -72,32 +91,64 @@ func (s SubjectTypeInt) String() string {
 }
 
 type DetailResultModel struct {
-	ID                   ulid.ULID   `json:"id"`
-	Subject              string      `json:"subject"`
-	SubjectType          string      `json:"subject_type"`
-	PersonInCharge       null.String `json:"person_in_charge"`
-	BenificiaryOwnership null.String `json:"benificiary_ownership"`
-	CaseDate             null.Time   `json:"date"`
-	DecisionNumber       null.String `json:"decision_number"`
-	Source               string      `json:"source"`
-	Link                 string      `json:"link"`
-	Nation               string      `json:"nation"`
-	PunishmentDuration   null.String `json:"punishment_duration"`
-	Type                 string      `json:"type"`
-	Year                 string      `json:"year"`
-	Summary              string      `json:"summary"`
-	Status               string      `json:"status"`
-	CreatedAt            null.Time   `json:"created_at"`
-	UpdatedAt            null.Time   `json:"updated_at"`
+	ID                   ulid.ULID      `json:"id"`
+	Subject              string         `json:"subject"`
+	SubjectType          string         `json:"subject_type"`
+	PersonInCharge       null.String    `json:"person_in_charge"`
+	BenificiaryOwnership null.String    `json:"benificiary_ownership"`
+	CaseDate             null.Time      `json:"date"`
+	DecisionNumber       null.String    `json:"decision_number"`
+	Source               string         `json:"source"`
+	Link                 string         `json:"link"`
+	Nation               string         `json:"nation"`
+	PunishmentDuration   null.String    `json:"punishment_duration"`
+	Type                 string         `json:"type"`
+	Year                 string         `json:"year"`
+	Summary              string         `json:"summary"`
+	Status               string         `json:"status"`
+	Extra                ExtraDataModel `json:"extra"`
+	CreatedAt            null.Time      `json:"created_at"`
+	UpdatedAt            null.Time      `json:"updated_at"`
 }
 
 var emptyDetail DetailResultModel
 
+// Detail is the public view of a case, with its extra data decoded and the
+// punishment period formatted.
+func (c CaseModel) Detail() DetailResultModel {
+	extra, err := ParseExtraData(c.ExtraData)
+	if err != nil {
+		// a malformed payload should not hide the case itself
+		log.Warn().Err(err).Msg("Error decoding extra data of case " + c.ID.String())
+	}
+
+	return DetailResultModel{
+		ID:                   c.ID,
+		Subject:              c.Subject,
+		SubjectType:          c.SubjectType,
+		PersonInCharge:       c.PersonInCharge,
+		BenificiaryOwnership: c.BenificiaryOwnership,
+		CaseDate:             c.CaseDate,
+		DecisionNumber:       c.DecisionNumber,
+		Source:               c.Source,
+		Link:                 c.Link,
+		Nation:               c.Nation,
+		PunishmentDuration:   null.NewString(c.PunishmentStart.Time.Format("02 Jan 2006")+" - "+c.PunishmentEnd.Time.Format("02 Jan 2006"), c.PunishmentStart.Valid && c.PunishmentEnd.Valid),
+		Type:                 c.Type,
+		Year:                 c.Year,
+		Summary:              c.Summary,
+		Status:               c.Status,
+		Extra:                extra,
+		CreatedAt:            c.CreatedAt,
+		UpdatedAt:            c.UpdatedAt,
+	}
+}
+
 func GetDetailById(ctx context.Context, tx pgx.Tx, id string) (DetailResultModel, error) {
 
 	log.Info().Msg("Start getting detail by id: " + id)
 	query := `
-	SELECT id, subject, subject_type, person_in_charge, benificiary_ownership, case_date, decision_number, source, link, nation, punishment_start, punishment_end, case_type, year, summary, status, created_at, updated_at
+	SELECT ` + caseColumns + `
 	FROM cases
 	WHERE id = $1
 	AND status = $2
@@ -105,57 +156,45 @@ func GetDetailById(ctx context.Context, tx pgx.Tx, id string) (DetailResultModel
 	`
 
 	log.Info().Msg("Executing query: " + query)
-	row := tx.QueryRow(ctx, query, id, validated)
-
-	temp := struct {
-		ID                   ulid.ULID
-		Subject              string
-		SubjectType          SubjectTypeInt
-		PersonInCharge       null.String
-		BenificiaryOwnership null.String
-		CaseDate             null.Time
-		DecisionNumber       null.String
-		Source               string
-		Link                 string
-		Nation               string
-		PunishmentStartDate  null.Time
-		PunishmentEndDate    null.Time
-		Type                 CaseType
-		Year                 string
-		Summary              string
-		Status               CaseStatus
-		CreatedAt            null.Time
-		UpdatedAt            null.Time
-	}{}
-	err := row.Scan(&temp.ID, &temp.Subject, &temp.SubjectType, &temp.PersonInCharge, &temp.BenificiaryOwnership, &temp.CaseDate, &temp.DecisionNumber, &temp.Source, &temp.Link, &temp.Nation, &temp.PunishmentStartDate, &temp.PunishmentEndDate, &temp.Type, &temp.Year, &temp.Summary, &temp.Status, &temp.CreatedAt, &temp.UpdatedAt)
+	c, err := scanCase(tx.QueryRow(ctx, query, id, validated))
 
 	if err != nil {
 		log.Info().Msg("Data Not Found")
 
 		return emptyDetail, err
 	}
-	// mapping temp to result
-	result := DetailResultModel{
-		ID:                   temp.ID,
-		Subject:              temp.Subject,
-		SubjectType:          temp.SubjectType.String(),
-		PersonInCharge:       temp.PersonInCharge,
-		BenificiaryOwnership: temp.BenificiaryOwnership,
-		CaseDate:             temp.CaseDate,
-		DecisionNumber:       temp.DecisionNumber,
-		Source:               temp.Source,
-		Link:                 temp.Link,
-		Nation:               temp.Nation,
-		PunishmentDuration:   null.NewString(temp.PunishmentStartDate.Time.Format("02 Jan 2006")+" - "+temp.PunishmentEndDate.Time.Format("02 Jan 2006"), temp.PunishmentStartDate.Valid && temp.PunishmentEndDate.Valid),
-		Type:                 temp.Type.String(),
-		Year:                 temp.Year,
-		Summary:              temp.Summary,
-		Status:               temp.Status.String(),
-		CreatedAt:            temp.CreatedAt,
-		UpdatedAt:            temp.UpdatedAt,
-	}
 
 	log.Info().Msg("Finish getting detail by id: " + id)
 	log.Info().Msg("Data Found")
-	return result, nil
+	return c.Detail(), nil
+}
+
+// GetIdsByCaseNumbers returns the ids of the cases with one of the decision
+// numbers.
+func GetIdsByCaseNumbers(ctx context.Context, tx pgx.Tx, caseNumbers []string) ([]string, error) {
+	var ids []string
+
+	query := `
+	SELECT id
+	FROM cases
+	WHERE decision_number = ANY($1)
+	`
+
+	row, err := tx.Query(ctx, query, caseNumbers)
+	if err != nil {
+		log.Err(err).Msg("Error executing query")
+		return nil, err
+	}
+	defer row.Close()
+	for row.Next() {
+		var id string
+		err := row.Scan(&id)
+		if err != nil {
+			log.Err(err).Msg("Error scanning row")
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
 }
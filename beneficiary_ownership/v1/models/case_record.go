@@ -0,0 +1,72 @@
+package bo_v1_models
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// caseRecordDateColumns hold dates, a plain YYYY-MM-DD is read as midnight UTC.
+var caseRecordDateColumns = map[string]bool{"case_date": true, "punishment_start": true, "punishment_end": true}
+
+var plainDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// DecodeCaseCSV turns CSV case records into the JSON objects the same records
+// are sent as, keyed on the header row. Empty cells are null and extra_data
+// holds raw JSON.
+func DecodeCaseCSV(r io.Reader) ([]json.RawMessage, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("csv has no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var records []json.RawMessage
+
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record := map[string]any{}
+
+		for i, column := range header {
+			value := row[i]
+
+			switch {
+			case value == "":
+				record[column] = nil
+			case column == "extra_data":
+				if !json.Valid([]byte(value)) {
+					return nil, fmt.Errorf("line %d: extra_data is not valid JSON", line)
+				}
+				record[column] = json.RawMessage(value)
+			case caseRecordDateColumns[column] && plainDate.MatchString(value):
+				record[column] = value + "T00:00:00Z"
+			default:
+				record[column] = value
+			}
+		}
+
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, encoded)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,151 @@
+package bo_v1_models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+// actions recorded in the revisions of a case
+const (
+	CaseCreated   = "created"
+	CaseUpdated   = "updated"
+	CaseValidated = "validated"
+	CaseDeleted   = "deleted"
+	CaseRestored  = "restored"
+)
+
+// CaseFieldChange is the value of a field before and after a revision, in
+// the JSON form the case is served in. Before is null for a created case.
+type CaseFieldChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// CaseRevisionModel is one write to a case, only the fields it changed are
+// listed.
+type CaseRevisionModel struct {
+	ID        ulid.ULID                  `json:"id"`
+	CaseID    string                     `json:"case_id"`
+	Actor     string                     `json:"actor,omitempty"`
+	Action    string                     `json:"action"`
+	Changes   map[string]CaseFieldChange `json:"changes"`
+	CreatedAt null.Time                  `json:"created_at"`
+}
+
+// revisionIgnoredFields change on every write and are left out of the diff.
+var revisionIgnoredFields = map[string]bool{"id": true, "created_at": true, "updated_at": true}
+
+// DiffCases lists the fields that differ between two states of a case. A zero
+// before, as for a created case, lists every field that is set.
+func DiffCases(before CaseModel, after CaseModel) (map[string]CaseFieldChange, error) {
+	afterFields, err := caseJSONFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	beforeFields := map[string]json.RawMessage{}
+	if before.ID.Compare(ulid.ULID{}) != 0 {
+		if beforeFields, err = caseJSONFields(before); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := map[string]CaseFieldChange{}
+
+	for field, value := range afterFields {
+		if revisionIgnoredFields[field] {
+			continue
+		}
+
+		previous, ok := beforeFields[field]
+		if ok && bytes.Equal(previous, value) || !ok && string(value) == "null" {
+			continue
+		}
+
+		changes[field] = CaseFieldChange{Before: beforeFields[field], After: value}
+	}
+
+	return changes, nil
+}
+
+func caseJSONFields(c CaseModel) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(encoded, &fields)
+
+	return fields, err
+}
+
+// recordCaseRevision appends a revision to the audit trail of a case. The
+// trail is never updated or deleted from.
+func recordCaseRevision(ctx context.Context, tx pgx.Tx, actor string, action string, before CaseModel, after CaseModel) error {
+	changes, err := DiffCases(before, after)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO case_revisions (id, case_id, actor, action, changes, created_at)
+	VALUES ($1, $2, $3, $4, $5, now())
+	`
+
+	_, err = tx.Exec(ctx, query, ulid.Make().String(), after.ID.String(), actor, action, changes)
+
+	return err
+}
+
+// GetCaseRevisions returns the audit trail of a published case, the oldest
+// revision first.
+func GetCaseRevisions(ctx context.Context, tx pgx.Tx, caseID string) ([]CaseRevisionModel, error) {
+	var published bool
+
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM cases WHERE id = $1 AND status = $2)`, caseID, validated).Scan(&published)
+	if err != nil {
+		return nil, err
+	}
+
+	if !published {
+		return nil, pgx.ErrNoRows
+	}
+
+	query := `
+	SELECT id, case_id, actor, action, changes, created_at
+	FROM case_revisions
+	WHERE case_id = $1
+	ORDER BY created_at ASC, id ASC
+	`
+
+	log.Info().Msg("Executing query: " + query)
+
+	rows, err := tx.Query(ctx, query, caseID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	revisions := []CaseRevisionModel{}
+
+	for rows.Next() {
+		var revision CaseRevisionModel
+
+		err = rows.Scan(&revision.ID, &revision.CaseID, &revision.Actor, &revision.Action, &revision.Changes, &revision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
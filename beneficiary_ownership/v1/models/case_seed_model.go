@@ -0,0 +1,67 @@
+package bo_v1_models
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// SeedCase is a fixture case, its fixed id makes seeding repeatable.
+type SeedCase struct {
+	ID     ulid.ULID `json:"id"`
+	Status string    `json:"status"`
+	CaseFields
+}
+
+// UpsertSeedCases inserts the fixture cases or brings existing ones back to
+// the fixture. Cases already matching their fixture are left untouched so a
+// repeated seed does not look like an edit to the watchlist worker.
+func UpsertSeedCases(ctx context.Context, tx pgx.Tx, cases []SeedCase) (int, error) {
+	query := `
+	INSERT INTO cases (id, subject, subject_type, person_in_charge, benificiary_ownership, case_date, decision_number, source, link, nation, punishment_start, punishment_end, case_type, year, summary, extra_data, status, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, now(), now())
+	ON CONFLICT (id) DO UPDATE SET
+		subject = EXCLUDED.subject, subject_type = EXCLUDED.subject_type, person_in_charge = EXCLUDED.person_in_charge,
+		benificiary_ownership = EXCLUDED.benificiary_ownership, case_date = EXCLUDED.case_date, decision_number = EXCLUDED.decision_number,
+		source = EXCLUDED.source, link = EXCLUDED.link, nation = EXCLUDED.nation, punishment_start = EXCLUDED.punishment_start,
+		punishment_end = EXCLUDED.punishment_end, case_type = EXCLUDED.case_type, year = EXCLUDED.year, summary = EXCLUDED.summary,
+		extra_data = EXCLUDED.extra_data, status = EXCLUDED.status, updated_at = now()
+	WHERE (cases.subject, cases.subject_type, cases.person_in_charge, cases.benificiary_ownership, cases.case_date, cases.decision_number,
+		cases.source, cases.link, cases.nation, cases.punishment_start, cases.punishment_end, cases.case_type, cases.year, cases.summary,
+		cases.extra_data, cases.status)
+	IS DISTINCT FROM (EXCLUDED.subject, EXCLUDED.subject_type, EXCLUDED.person_in_charge, EXCLUDED.benificiary_ownership, EXCLUDED.case_date, EXCLUDED.decision_number,
+		EXCLUDED.source, EXCLUDED.link, EXCLUDED.nation, EXCLUDED.punishment_start, EXCLUDED.punishment_end, EXCLUDED.case_type, EXCLUDED.year, EXCLUDED.summary,
+		EXCLUDED.extra_data, EXCLUDED.status)
+	`
+
+	log.Info().Msg("Executing query: " + query)
+
+	written := 0
+
+	for _, c := range cases {
+		if c.ID == (ulid.ULID{}) {
+			return written, fmt.Errorf("case of subject %q: id is required", c.Subject)
+		}
+
+		if err := c.Validate(); err != nil {
+			return written, fmt.Errorf("case %s: %w", c.ID, err)
+		}
+
+		status, ok := newCaseStatus(c.Status)
+		if !ok {
+			return written, fmt.Errorf("case %s: status must be one of validated, draft, deleted", c.ID)
+		}
+
+		tag, err := tx.Exec(ctx, query, c.ID.String(), c.Subject, newSubjectType(c.SubjectType), c.PersonInCharge, c.BenificiaryOwnership, c.CaseDate, c.DecisionNumber, c.Source, c.Link, c.Nation, c.PunishmentStart, c.PunishmentEnd, newCaseType(c.Type), c.Year, c.Summary, c.ExtraData, status)
+		if err != nil {
+			return written, fmt.Errorf("case %s: %w", c.ID, err)
+		}
+
+		written += int(tag.RowsAffected())
+	}
+
+	return written, nil
+}
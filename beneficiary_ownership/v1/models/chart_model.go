@@ -2,38 +2,71 @@ package bo_v1_models
 
 import (
 	"context"
+	"time"
 
 	common_models "lexicon/bo-api/common/models"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
 )
 
 type ChartsModel struct {
-	Countries    []common_models.BaseChartModel `json:"countries"`
-	SubjectTypes []common_models.BaseChartModel `json:"subjet_types"`
-	CaseTypes    []common_models.BaseChartModel `json:"case_types"`
+	Countries        []common_models.BaseChartModel `json:"countries"`
+	SubjectTypes     []common_models.BaseChartModel `json:"subjet_types"`
+	CaseTypes        []common_models.BaseChartModel `json:"case_types"`
+	CaseTypesPerYear []YearlyChartModel             `json:"case_types_per_year"`
+	// GeneratedAt is when the counts were taken, the last refresh of the
+	// aggregates unless the request searched the text of the cases
+	GeneratedAt null.Time `json:"generated_at"`
+}
+
+type YearlyChartModel struct {
+	Year      string                         `json:"year"`
+	CaseTypes []common_models.BaseChartModel `json:"case_types"`
 }
 
 var emptyChartModel ChartsModel
 
-func ChartData(ctx context.Context, tx pgx.Tx) (ChartsModel, error) {
+// chartSource is what the charts count, the aggregated case_stats unless the
+// request searches the text of the cases, which only the cases have.
+func chartSource(searchRequest SearchRequest) (from string, value string) {
+	if searchRequest.Query == "" {
+		return caseStats + " c", "sum(c.total)::bigint"
+	}
+
+	return "cases c", "count(*)"
+}
+
+// ChartData aggregates the cases matching the search request, validated cases
+// only unless the request asks for other statuses. Without a query the counts
+// come from case_stats, as of its last refresh.
+func ChartData(ctx context.Context, tx pgx.Tx, searchRequest SearchRequest) (ChartsModel, error) {
 
 	var chartsResult ChartsModel
 
+	if err := applyFuzzyThreshold(ctx, tx, searchRequest); err != nil {
+		return emptyChartModel, err
+	}
+
+	whereClause := searchWhereClause(searchRequest)
+	filterArgs := searchFilterArgs(searchRequest)
+	from, value := chartSource(searchRequest)
+
 	// Get Countries Chart Data
 	countriesQuery := `
 		SELECT 
 			c.nation name,
-			count(c.nation) value
+			` + value + ` value
 		FROM 
-			cases c 
+			` + from + `
+		` + whereClause + `
 		GROUP BY
 			c.nation
 	`
 	log.Info().Msg("Executing query: " + countriesQuery)
 
-	countries, err := tx.Query(ctx, countriesQuery)
+	countries, err := tx.Query(ctx, countriesQuery, filterArgs...)
 
 	log.Info().Msg("Finish countries query")
 
@@ -64,15 +97,16 @@ func ChartData(ctx context.Context, tx pgx.Tx) (ChartsModel, error) {
 				WHEN c.subject_type = 2 THEN 'Company'
 				WHEN c.subject_type = 3 THEN 'Organization'
 			END name,
-			count(c.subject_type) value
+			` + value + ` value
 		FROM 
-			cases c
+			` + from + `
+		` + whereClause + `
 		GROUP BY
 			c.subject_type
 	`
 	log.Info().Msg("Executing query: " + subjectTypesQuery)
 
-	subjectTypes, err := tx.Query(ctx, subjectTypesQuery)
+	subjectTypes, err := tx.Query(ctx, subjectTypesQuery, filterArgs...)
 
 	log.Info().Msg("Subject Types query executed")
 
@@ -103,15 +137,16 @@ func ChartData(ctx context.Context, tx pgx.Tx) (ChartsModel, error) {
 				WHEN c.case_type = 2 THEN 'Blacklist'
 				WHEN c.case_type = 3 THEN 'Sanction'
 			END name,
-			count(c.case_type) value
+			` + value + ` value
 		FROM 
-			cases c 
+			` + from + `
+		` + whereClause + `
 		GROUP BY
 			c.case_type
 	`
 	log.Info().Msg("Executing query: " + caseTypesQuery)
 
-	caseTypes, err := tx.Query(ctx, caseTypesQuery)
+	caseTypes, err := tx.Query(ctx, caseTypesQuery, filterArgs...)
 
 	log.Info().Msg("Case Types query executed")
 
@@ -134,5 +169,64 @@ func ChartData(ctx context.Context, tx pgx.Tx) (ChartsModel, error) {
 		chartsResult.CaseTypes = append(chartsResult.CaseTypes, chartResult)
 	}
 
+	// Get Case Types per Year Chart Data
+	caseTypesPerYearQuery := `
+		SELECT
+			c.year,
+			CASE 
+				WHEN c.case_type = 1 THEN 'Verdict'
+				WHEN c.case_type = 2 THEN 'Blacklist'
+				WHEN c.case_type = 3 THEN 'Sanction'
+			END name,
+			` + value + ` value
+		FROM 
+			` + from + `
+		` + whereClause + `
+		GROUP BY
+			c.year, c.case_type
+		ORDER BY
+			c.year ASC, c.case_type ASC
+	`
+	log.Info().Msg("Executing query: " + caseTypesPerYearQuery)
+
+	caseTypesPerYear, err := tx.Query(ctx, caseTypesPerYearQuery, filterArgs...)
+
+	log.Info().Msg("Case Types per Year query executed")
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error querying database")
+		return emptyChartModel, err
+	}
+
+	defer caseTypesPerYear.Close()
+
+	for caseTypesPerYear.Next() {
+		var year string
+		var chartResult common_models.BaseChartModel
+
+		err = caseTypesPerYear.Scan(&year, &chartResult.Name, &chartResult.Value)
+
+		if err != nil {
+			return emptyChartModel, err
+		}
+
+		last := len(chartsResult.CaseTypesPerYear) - 1
+		if last < 0 || chartsResult.CaseTypesPerYear[last].Year != year {
+			chartsResult.CaseTypesPerYear = append(chartsResult.CaseTypesPerYear, YearlyChartModel{Year: year})
+			last++
+		}
+
+		chartsResult.CaseTypesPerYear[last].CaseTypes = append(chartsResult.CaseTypesPerYear[last].CaseTypes, chartResult)
+	}
+
+	if searchRequest.Query == "" {
+		chartsResult.GeneratedAt, err = aggregateRefreshedAt(ctx, tx, caseStats)
+		if err != nil {
+			return emptyChartModel, err
+		}
+	} else {
+		chartsResult.GeneratedAt = null.TimeFrom(time.Now())
+	}
+
 	return chartsResult, nil
 }
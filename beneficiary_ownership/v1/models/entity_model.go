@@ -0,0 +1,119 @@
+package bo_v1_models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+type EntityAliasModel struct {
+	Alias      string  `json:"alias"`
+	Confidence float64 `json:"confidence"`
+}
+
+type EntityCaseModel struct {
+	SearchResultModel
+	Role       string  `json:"role"`
+	Confidence float64 `json:"confidence"`
+}
+
+type EntityModel struct {
+	ID      string             `json:"id"`
+	Name    string             `json:"name"`
+	Type    string             `json:"type"`
+	Aliases []EntityAliasModel `json:"aliases"`
+	Cases   []EntityCaseModel  `json:"cases"`
+}
+
+var emptyEntity EntityModel
+
+// GetEntityById returns an entity with its known spellings and every
+// validated case it takes part in, either as subject or as a named party.
+func GetEntityById(ctx context.Context, tx pgx.Tx, id string) (EntityModel, error) {
+	log.Info().Msg("Start getting entity by id: " + id)
+
+	var entity EntityModel
+	var entityType SubjectTypeInt
+
+	err := tx.QueryRow(ctx, `SELECT id, name, entity_type FROM entities WHERE id = $1`, id).Scan(&entity.ID, &entity.Name, &entityType)
+	if err != nil {
+		log.Info().Msg("Data Not Found")
+		return emptyEntity, err
+	}
+
+	entity.Type = entityType.String()
+
+	aliasQuery := `
+	SELECT alias, confidence
+	FROM entity_aliases
+	WHERE entity_id = $1
+	ORDER BY confidence DESC, alias ASC
+	`
+
+	log.Info().Msg("Executing query: " + aliasQuery)
+
+	rows, err := tx.Query(ctx, aliasQuery, id)
+	if err != nil {
+		return emptyEntity, err
+	}
+
+	entity.Aliases, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (EntityAliasModel, error) {
+		var alias EntityAliasModel
+		err := row.Scan(&alias.Alias, &alias.Confidence)
+		return alias, err
+	})
+	if err != nil {
+		return emptyEntity, err
+	}
+
+	caseQuery := `
+	SELECT cases.id, cases.subject, cases.subject_type, cases.person_in_charge, cases.benificiary_ownership, cases.nation, cases.case_type, cases.year, ` + subjectEntityColumn + `, r.role, r.confidence
+	FROM entity_relations r
+	JOIN cases ON cases.id = r.case_id
+	WHERE r.source_entity_id = $1
+	AND cases.status = $2
+	ORDER BY cases.year DESC, cases.id ASC
+	`
+
+	log.Info().Msg("Executing query: " + caseQuery)
+
+	rows, err = tx.Query(ctx, caseQuery, id, validated)
+	if err != nil {
+		log.Error().Err(err).Msg("Error querying database")
+		return emptyEntity, err
+	}
+
+	entity.Cases, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (EntityCaseModel, error) {
+		var temp tempSearchResult
+		var role RelationRole
+		var result EntityCaseModel
+
+		err := row.Scan(&temp.ID, &temp.Subject, &temp.SubjectType, &temp.PersonInCharge, &temp.BenificiaryOwnership, &temp.Nation, &temp.Type, &temp.Year, &temp.EntityID, &role, &result.Confidence)
+		if err != nil {
+			return result, err
+		}
+
+		result.SearchResultModel = SearchResultModel{
+			ID:                   temp.ID,
+			Subject:              temp.Subject,
+			SubjectType:          temp.SubjectType.String(),
+			PersonInCharge:       temp.PersonInCharge,
+			BenificiaryOwnership: temp.BenificiaryOwnership,
+			Nation:               temp.Nation,
+			Type:                 temp.Type.String(),
+			Year:                 temp.Year,
+			EntityID:             temp.EntityID,
+		}
+		result.Role = role.String()
+
+		return result, nil
+	})
+	if err != nil {
+		return emptyEntity, err
+	}
+
+	log.Info().Msg("Finish getting entity by id: " + id)
+
+	return entity, nil
+}
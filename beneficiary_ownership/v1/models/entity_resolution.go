@@ -0,0 +1,345 @@
+package bo_v1_models
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// entityMatchThreshold is the lowest similarity at which two subject
+// spellings are considered the same entity.
+const entityMatchThreshold = 0.9
+
+var (
+	// dotted abbreviations such as P.T. or S.H. are collapsed into one token
+	dottedAbbreviation = regexp.MustCompile(`^(?:[A-Z]\.)+[A-Z]?\.?$`)
+
+	// legal forms of Indonesian and foreign companies
+	companyLegalForms = map[string]bool{
+		"PT": true, "CV": true, "UD": true, "PD": true, "FA": true, "TBK": true, "PERSERO": true,
+		"PERUM": true, "LTD": true, "LIMITED": true, "INC": true, "CO": true, "CORP": true,
+		"CORPORATION": true, "LLC": true, "PTE": true, "BHD": true, "SDN": true, "GMBH": true,
+	}
+
+	// honorifics placed before a personal name
+	personalTitles = map[string]bool{
+		"DR": true, "IR": true, "DRS": true, "DRA": true, "H": true, "HJ": true, "PROF": true,
+		"BPK": true, "BAPAK": true, "IBU": true, "SDR": true, "SDRI": true, "TN": true, "NY": true,
+	}
+
+	// academic degrees placed after a personal name
+	academicDegrees = map[string]bool{
+		"SH": true, "SE": true, "MM": true, "MH": true, "ST": true, "SPD": true, "SKOM": true,
+		"SSOS": true, "SIP": true, "MBA": true, "MSI": true, "MT": true, "MKN": true, "AMD": true,
+		"PHD": true, "MSC": true, "BSC": true, "BA": true, "SAG": true, "MAG": true, "SPSI": true,
+	}
+)
+
+// normalizeEntityName is the key entities are deduplicated on. Legal forms of
+// companies, honorifics and academic degrees are dropped so that "PT. ABC",
+// "PT ABC Tbk" and "ABC" share a key.
+func normalizeEntityName(name string) string {
+	var tokens []string
+
+	for _, field := range strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return r == ' ' || r == ',' || r == '\t' || r == '\n'
+	}) {
+		if dottedAbbreviation.MatchString(field) {
+			tokens = append(tokens, strings.ReplaceAll(field, ".", ""))
+			continue
+		}
+
+		var b strings.Builder
+		for _, r := range field {
+			if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				b.WriteRune(r)
+			} else {
+				b.WriteRune(' ')
+			}
+		}
+		tokens = append(tokens, strings.Fields(b.String())...)
+	}
+
+	start, end := 0, len(tokens)
+
+	for start < end && (companyLegalForms[tokens[start]] || personalTitles[tokens[start]]) {
+		start++
+	}
+
+	for end > start && (companyLegalForms[tokens[end-1]] || academicDegrees[tokens[end-1]]) {
+		end--
+	}
+
+	// a name made only of stripped words is kept as is
+	if start == end {
+		return strings.Join(tokens, " ")
+	}
+
+	return strings.Join(tokens[start:end], " ")
+}
+
+// entitySimilarity scores two normalized names between 0 and 1, taking the
+// better of the plain and the word order independent comparison.
+func entitySimilarity(a string, b string) float64 {
+	if a == b {
+		return 1
+	}
+
+	plain := levenshteinRatio(a, b)
+	sorted := levenshteinRatio(sortTokens(a), sortTokens(b))
+
+	if sorted > plain {
+		return sorted
+	}
+	return plain
+}
+
+func sortTokens(s string) string {
+	tokens := strings.Fields(s)
+	sort.Strings(tokens)
+	return strings.Join(tokens, " ")
+}
+
+func levenshteinRatio(a string, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+
+	if longest == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return 1 - float64(previous[len(rb)])/float64(longest)
+}
+
+// subjectSpelling is one normalized subject name and the raw spellings that
+// normalize to it.
+type subjectSpelling struct {
+	Type      SubjectTypeInt
+	Key       string
+	Spellings map[string]int
+	Count     int
+	parent    int
+}
+
+func findCluster(spellings []subjectSpelling, i int) int {
+	for spellings[i].parent != i {
+		spellings[i].parent = spellings[spellings[i].parent].parent
+		i = spellings[i].parent
+	}
+	return i
+}
+
+// clusterSubjects groups the spellings of the same entity. Only spellings
+// sharing a blocking key are compared, a blocking key is the start of either
+// the name or its sorted words. Persons are never matched on similarity,
+// "BUDI SANTOSO" and "BUDI SANTOSA" are as likely two people as one, so a
+// person only shares an entity with the spellings of its normalized name.
+func clusterSubjects(spellings []subjectSpelling) [][]int {
+	blocks := map[string][]int{}
+
+	for i := range spellings {
+		spellings[i].parent = i
+
+		if spellings[i].Type == individual {
+			continue
+		}
+
+		seen := map[string]bool{}
+		for _, key := range []string{spellings[i].Key, sortTokens(spellings[i].Key)} {
+			prefix := key
+			if len(prefix) > 2 {
+				prefix = prefix[:2]
+			}
+			block := spellings[i].Type.String() + ":" + prefix
+			if !seen[block] {
+				seen[block] = true
+				blocks[block] = append(blocks[block], i)
+			}
+		}
+	}
+
+	for _, members := range blocks {
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				a, b := members[x], members[y]
+
+				if findCluster(spellings, a) == findCluster(spellings, b) {
+					continue
+				}
+
+				// names of very different length can not reach the threshold
+				la, lb := float64(len(spellings[a].Key)), float64(len(spellings[b].Key))
+				if la/lb < entityMatchThreshold && lb/la < entityMatchThreshold {
+					continue
+				}
+
+				if entitySimilarity(spellings[a].Key, spellings[b].Key) >= entityMatchThreshold {
+					spellings[findCluster(spellings, a)].parent = findCluster(spellings, b)
+				}
+			}
+		}
+	}
+
+	clusters := map[int][]int{}
+	for i := range spellings {
+		root := findCluster(spellings, i)
+		clusters[root] = append(clusters[root], i)
+	}
+
+	var result [][]int
+	for _, members := range clusters {
+		result = append(result, members)
+	}
+
+	return result
+}
+
+// ResolveEntities clusters the subjects of validated cases into canonical
+// entities. Every normalized spelling is stored as an alias of its entity with
+// the similarity to the canonical name as confidence.
+func ResolveEntities(ctx context.Context, tx pgx.Tx) (int, error) {
+	query := `
+	SELECT subject, subject_type, count(*)
+	FROM cases
+	WHERE status = $1
+	GROUP BY 1, 2
+	`
+
+	log.Info().Msg("Start resolving entities")
+	log.Info().Msg("Executing query: " + query)
+
+	rows, err := tx.Query(ctx, query, validated)
+	if err != nil {
+		return 0, err
+	}
+
+	byKey := map[string]int{}
+	var spellings []subjectSpelling
+
+	for rows.Next() {
+		var subject string
+		var subjectType SubjectTypeInt
+		var count int
+
+		if err = rows.Scan(&subject, &subjectType, &count); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		key := normalizeEntityName(subject)
+		if key == "" {
+			continue
+		}
+
+		index, ok := byKey[subjectType.String()+":"+key]
+		if !ok {
+			index = len(spellings)
+			byKey[subjectType.String()+":"+key] = index
+			spellings = append(spellings, subjectSpelling{Type: subjectType, Key: key, Spellings: map[string]int{}})
+		}
+
+		spellings[index].Spellings[subject] += count
+		spellings[index].Count += count
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	clusters := clusterSubjects(spellings)
+
+	for _, members := range clusters {
+		// the most used spelling names the entity
+		sort.Slice(members, func(i, j int) bool {
+			a, b := spellings[members[i]], spellings[members[j]]
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return len(a.Key) < len(b.Key)
+		})
+
+		canonical := spellings[members[0]]
+		entityID, err := upsertCanonicalEntity(ctx, tx, mostUsedSpelling(canonical.Spellings), canonical.Type, canonical.Key)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, member := range members {
+			spelling := spellings[member]
+
+			err = upsertEntityAlias(ctx, tx, entityID, spelling.Type, mostUsedSpelling(spelling.Spellings), spelling.Key, entitySimilarity(spelling.Key, canonical.Key))
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	log.Info().Msgf("Finish resolving entities, %d subject spellings in %d entities", len(spellings), len(clusters))
+
+	return len(clusters), nil
+}
+
+func mostUsedSpelling(spellings map[string]int) string {
+	best, bestCount := "", 0
+	for spelling, count := range spellings {
+		if count > bestCount || count == bestCount && spelling < best {
+			best, bestCount = spelling, count
+		}
+	}
+	return best
+}
+
+func upsertCanonicalEntity(ctx context.Context, tx pgx.Tx, name string, entityType SubjectTypeInt, key string) (string, error) {
+	query := `
+	INSERT INTO entities (id, entity_type, name, normalized_name, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, now(), now())
+	ON CONFLICT (entity_type, normalized_name) DO UPDATE SET name = EXCLUDED.name, updated_at = now()
+	RETURNING id
+	`
+
+	var id string
+	err := tx.QueryRow(ctx, query, ulid.Make().String(), entityType, name, key).Scan(&id)
+
+	return id, err
+}
+
+func upsertEntityAlias(ctx context.Context, tx pgx.Tx, entityID string, entityType SubjectTypeInt, alias string, key string, confidence float64) error {
+	query := `
+	INSERT INTO entity_aliases (entity_id, entity_type, alias, normalized_alias, confidence)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (entity_type, normalized_alias) DO UPDATE SET entity_id = EXCLUDED.entity_id, alias = EXCLUDED.alias, confidence = EXCLUDED.confidence
+	`
+
+	_, err := tx.Exec(ctx, query, entityID, entityType, alias, key, confidence)
+
+	return err
+}
@@ -0,0 +1,88 @@
+package bo_v1_models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+type ExportResultModel struct {
+	ID                   ulid.ULID   `json:"id"`
+	Subject              string      `json:"subject"`
+	SubjectType          string      `json:"subject_type"`
+	PersonInCharge       null.String `json:"person_in_charge"`
+	BenificiaryOwnership null.String `json:"benificiary_ownership"`
+	CaseDate             null.Time   `json:"date"`
+	DecisionNumber       null.String `json:"decision_number"`
+	Source               string      `json:"source"`
+	Link                 string      `json:"link"`
+	Nation               string      `json:"nation"`
+	PunishmentStart      null.Time   `json:"punishment_start"`
+	PunishmentEnd        null.Time   `json:"punishment_end"`
+	Type                 string      `json:"type"`
+	Year                 string      `json:"year"`
+	Summary              string      `json:"summary"`
+}
+
+// ExportByRequest streams every row matching the search request to the
+// writer, in the order of the requested sort. Rows are read one at a time from
+// the connection, so the result set is never held in memory.
+func ExportByRequest(ctx context.Context, tx pgx.Tx, searchRequest SearchRequest, writer ExportWriter) error {
+	sort := searchRequest.Sort.orDefault()
+
+	direction := "ASC"
+	if sort.Desc {
+		direction = "DESC"
+	}
+
+	if err := applyFuzzyThreshold(ctx, tx, searchRequest); err != nil {
+		return err
+	}
+
+	log.Info().Msg("Start export query")
+	exportQuery := `SELECT id, subject, subject_type, person_in_charge, benificiary_ownership, case_date, decision_number, source, link, nation, punishment_start, punishment_end, case_type, year, summary
+	FROM cases ` + searchWhereClause(searchRequest) + `
+	ORDER BY ` + sort.key(searchRequest) + ` ` + direction + `, id ASC`
+
+	log.Info().Msg("Executing query: " + exportQuery)
+
+	rows, err := tx.Query(ctx, exportQuery, searchFilterArgs(searchRequest)...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error querying database")
+		return err
+	}
+
+	defer rows.Close()
+
+	exported := 0
+
+	for rows.Next() {
+		var result ExportResultModel
+		var subjectType SubjectTypeInt
+		var caseType CaseType
+
+		err = rows.Scan(&result.ID, &result.Subject, &subjectType, &result.PersonInCharge, &result.BenificiaryOwnership, &result.CaseDate, &result.DecisionNumber, &result.Source, &result.Link, &result.Nation, &result.PunishmentStart, &result.PunishmentEnd, &caseType, &result.Year, &result.Summary)
+		if err != nil {
+			return err
+		}
+
+		result.SubjectType = subjectType.String()
+		result.Type = caseType.String()
+
+		if err = writer.Write(result); err != nil {
+			return err
+		}
+		exported++
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	log.Info().Msgf("Finish export query, %d rows exported", exported)
+
+	return writer.Flush()
+}
@@ -0,0 +1,96 @@
+package bo_v1_models
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ExportWriter encodes exported rows into a download format.
+type ExportWriter interface {
+	Write(result ExportResultModel) error
+	Flush() error
+}
+
+var exportCSVHeader = []string{
+	"id", "subject", "subject_type", "person_in_charge", "benificiary_ownership", "date",
+	"decision_number", "source", "link", "nation", "punishment_start", "punishment_end",
+	"type", "year", "summary",
+}
+
+type csvExportWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func NewCSVExportWriter(w io.Writer) ExportWriter {
+	return &csvExportWriter{writer: csv.NewWriter(w)}
+}
+
+func (c *csvExportWriter) Write(result ExportResultModel) error {
+	if !c.headerWritten {
+		if err := c.writer.Write(exportCSVHeader); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	return c.writer.Write([]string{
+		result.ID.String(),
+		result.Subject,
+		result.SubjectType,
+		result.PersonInCharge.String,
+		result.BenificiaryOwnership.String,
+		formatExportDate(result.CaseDate.Time, result.CaseDate.Valid),
+		result.DecisionNumber.String,
+		result.Source,
+		result.Link,
+		result.Nation,
+		formatExportDate(result.PunishmentStart.Time, result.PunishmentStart.Valid),
+		formatExportDate(result.PunishmentEnd.Time, result.PunishmentEnd.Valid),
+		result.Type,
+		result.Year,
+		result.Summary,
+	})
+}
+
+func (c *csvExportWriter) Flush() error {
+	// an empty export still gets a header so the file opens as a table
+	if !c.headerWritten {
+		if err := c.writer.Write(exportCSVHeader); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type ndjsonExportWriter struct {
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func NewNDJSONExportWriter(w io.Writer) ExportWriter {
+	buffer := bufio.NewWriter(w)
+	return &ndjsonExportWriter{buffer: buffer, encoder: json.NewEncoder(buffer)}
+}
+
+func (n *ndjsonExportWriter) Write(result ExportResultModel) error {
+	// Encode terminates every value with a newline
+	return n.encoder.Encode(result)
+}
+
+func (n *ndjsonExportWriter) Flush() error {
+	return n.buffer.Flush()
+}
+
+func formatExportDate(t time.Time, valid bool) string {
+	if !valid {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,101 @@
+package bo_v1_models
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+// extraDataLkpp is the type of the entries scraped from the LKPP national
+// procurement blacklist.
+const extraDataLkpp = "LKPP"
+
+// ExtraDataEntry is one element of cases.extra_data as it is stored, the
+// shape of Data depends on Type.
+type ExtraDataEntry struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// LkppExtraData is the data of an LKPP entry, the fields the LKPP charts
+// group on.
+type LkppExtraData struct {
+	Province        string      `json:"province"`
+	InstitutionArea string      `json:"institution_area"`
+	Ceiling         ExtraAmount `json:"ceiling"`
+	Scenario        string      `json:"scenario"`
+	Rule            string      `json:"rule"`
+}
+
+// ExtraAmount is an amount in rupiah which the sources send either as a
+// number or as a string of digits.
+type ExtraAmount struct {
+	null.Int
+}
+
+func (a *ExtraAmount) UnmarshalJSON(data []byte) error {
+	raw := strings.Trim(string(data), `"`)
+
+	if raw == "" || raw == "null" || raw == "-" {
+		a.Int = null.Int{}
+		return nil
+	}
+
+	amount, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		// amounts we can not read are left empty rather than failing the case
+		a.Int = null.Int{}
+		return nil
+	}
+
+	a.Int = null.IntFrom(int64(amount))
+	return nil
+}
+
+// ExtraDataModel is cases.extra_data decoded per source type. Entries of a
+// type without a model of its own are kept as stored in Others.
+type ExtraDataModel struct {
+	Lkpp   []LkppExtraData  `json:"lkpp"`
+	Others []ExtraDataEntry `json:"others"`
+}
+
+// ParseExtraData decodes every entry of the extra_data column, which is an
+// array of entries or, for older rows, a single entry.
+func ParseExtraData(raw []byte) (ExtraDataModel, error) {
+	extra := ExtraDataModel{Lkpp: []LkppExtraData{}, Others: []ExtraDataEntry{}}
+
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return extra, nil
+	}
+
+	var entries []ExtraDataEntry
+
+	if raw[0] == '{' {
+		var entry ExtraDataEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return extra, err
+		}
+		entries = append(entries, entry)
+	} else if err := json.Unmarshal(raw, &entries); err != nil {
+		return extra, err
+	}
+
+	for _, entry := range entries {
+		switch strings.ToUpper(entry.Type) {
+		case extraDataLkpp:
+			var lkpp LkppExtraData
+			if err := json.Unmarshal(entry.Data, &lkpp); err != nil {
+				return extra, err
+			}
+			extra.Lkpp = append(extra.Lkpp, lkpp)
+		default:
+			extra.Others = append(extra.Others, entry)
+		}
+	}
+
+	return extra, nil
+}
@@ -0,0 +1,320 @@
+package bo_v1_models
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+// ExtractedParty is a person or company named in the free text
+// benificiary_ownership or person_in_charge column of a case.
+type ExtractedParty struct {
+	Name       string
+	Type       SubjectTypeInt
+	Percentage null.Float
+}
+
+var (
+	partySeparator    = regexp.MustCompile(`\s*[;,\n]\s*`)
+	partyConjunction  = regexp.MustCompile(`(?i)\s+(?:dan|and)\s+`)
+	decimalComma      = regexp.MustCompile(`(\d),(\d)`)
+	partyPercentage   = regexp.MustCompile(`\(?\s*(\d{1,3}(?:\.\d+)?)\s*%\s*\)?`)
+	companyNamePrefix = regexp.MustCompile(`(?i)^(?:PT|CV|UD|PD|FA|KOPERASI|YAYASAN)\b\.?`)
+	// corporate suffixes are separated by a comma from the name they belong
+	// to, they are joined back after splitting the parties
+	companyNameSuffix = regexp.MustCompile(`(?i)^(?:TBK|LTD|INC|LLC|CORP|PTE|BHD)\.?$`)
+	emptyPartyNames   = map[string]bool{"": true, "-": true, "TIDAK ADA": true, "N/A": true, "NONE": true}
+)
+
+// ParseParties splits the free text of a benificiary_ownership or
+// person_in_charge column into the parties it names, reading an optional
+// ownership percentage after each name.
+func ParseParties(text string) []ExtractedParty {
+	var parts []string
+
+	// decimal commas would otherwise split a percentage in two
+	text = decimalComma.ReplaceAllString(strings.TrimSpace(text), "$1.$2")
+
+	for _, part := range splitParties(text) {
+		suffix := strings.TrimSpace(partyPercentage.ReplaceAllString(part, ""))
+		if companyNameSuffix.MatchString(suffix) && len(parts) > 0 {
+			parts[len(parts)-1] += ", " + part
+			continue
+		}
+		parts = append(parts, part)
+	}
+
+	var parties []ExtractedParty
+
+	for _, part := range parts {
+		party := ExtractedParty{Type: individual}
+
+		if match := partyPercentage.FindStringSubmatch(part); match != nil {
+			percentage, err := strconv.ParseFloat(match[1], 64)
+			if err == nil && percentage <= 100 {
+				party.Percentage = null.FloatFrom(percentage)
+			}
+			part = partyPercentage.ReplaceAllString(part, "")
+		}
+
+		party.Name = strings.Trim(strings.Join(strings.Fields(part), " "), " .,-:")
+
+		if emptyPartyNames[strings.ToUpper(party.Name)] {
+			continue
+		}
+
+		if companyNamePrefix.MatchString(party.Name) {
+			party.Type = company
+		}
+
+		parties = append(parties, party)
+	}
+
+	return parties
+}
+
+// splitParties splits text on the separators of a list. A "dan" or "and" is
+// part of names such as "PT Sinar Dan Jaya" or "Smith and Sons Ltd" as often
+// as it joins two parties, so it only splits between two sides that are each
+// marked as a party of their own.
+func splitParties(text string) []string {
+	var parts []string
+
+	for _, part := range partySeparator.Split(text, -1) {
+		start := 0
+
+		for _, conjunction := range partyConjunction.FindAllStringIndex(part, -1) {
+			next := conjunction[1]
+			if end := partyConjunction.FindStringIndex(part[next:]); end != nil {
+				next += end[0]
+			} else {
+				next = len(part)
+			}
+
+			if hasPartyMarker(part[start:conjunction[0]]) && hasPartyMarker(part[conjunction[1]:next]) {
+				parts = append(parts, part[start:conjunction[0]])
+				start = conjunction[1]
+			}
+		}
+
+		parts = append(parts, part[start:])
+	}
+
+	return parts
+}
+
+// hasPartyMarker reports whether text starts with the legal form of a company
+// or a personal title, or carries an ownership percentage.
+func hasPartyMarker(text string) bool {
+	if companyNamePrefix.MatchString(text) || partyPercentage.MatchString(text) {
+		return true
+	}
+
+	fields := strings.Fields(strings.ToUpper(text))
+	return len(fields) > 0 && personalTitles[strings.Trim(fields[0], ".,")]
+}
+
+type graphCaseRow struct {
+	ID                   string
+	Subject              string
+	SubjectType          SubjectTypeInt
+	PersonInCharge       null.String
+	BenificiaryOwnership null.String
+}
+
+// upsertEntity returns the id of the entity a name resolves to and the
+// confidence of that match. A name without a known alias creates a new entity.
+func upsertEntity(ctx context.Context, tx pgx.Tx, name string, entityType SubjectTypeInt) (string, float64, error) {
+	key := normalizeEntityName(name)
+
+	var id string
+	var confidence float64
+
+	err := tx.QueryRow(ctx, `SELECT entity_id, confidence FROM entity_aliases WHERE entity_type = $1 AND normalized_alias = $2`, entityType, key).Scan(&id, &confidence)
+	if err == nil {
+		return id, confidence, nil
+	}
+
+	if err != pgx.ErrNoRows {
+		return "", 0, err
+	}
+
+	id, err = upsertCanonicalEntity(ctx, tx, name, entityType, key)
+	if err != nil {
+		return "", 0, err
+	}
+
+	err = upsertEntityAlias(ctx, tx, id, entityType, name, key, 1)
+
+	return id, 1, err
+}
+
+func insertRelation(ctx context.Context, tx pgx.Tx, caseID string, sourceID string, targetID null.String, role RelationRole, percentage null.Float, confidence float64) error {
+	query := `
+	INSERT INTO entity_relations (id, case_id, source_entity_id, target_entity_id, role, percentage, confidence, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, now())
+	`
+
+	_, err := tx.Exec(ctx, query, ulid.Make().String(), caseID, sourceID, targetID, role, percentage, confidence)
+
+	return err
+}
+
+// syncGraphCase replaces the relations extracted from a single case.
+func syncGraphCase(ctx context.Context, tx pgx.Tx, c graphCaseRow) error {
+	_, err := tx.Exec(ctx, `DELETE FROM entity_relations WHERE case_id = $1`, c.ID)
+	if err != nil {
+		return err
+	}
+
+	subjectID, confidence, err := upsertEntity(ctx, tx, c.Subject, c.SubjectType)
+	if err != nil {
+		return err
+	}
+
+	err = insertRelation(ctx, tx, c.ID, subjectID, null.String{}, subjectOf, null.Float{}, confidence)
+	if err != nil {
+		return err
+	}
+
+	roles := []struct {
+		text null.String
+		role RelationRole
+	}{
+		{c.BenificiaryOwnership, beneficialOwner},
+		{c.PersonInCharge, personInCharge},
+	}
+
+	for _, r := range roles {
+		if !r.text.Valid {
+			continue
+		}
+
+		for _, party := range ParseParties(r.text.String) {
+			partyID, confidence, err := upsertEntity(ctx, tx, party.Name, party.Type)
+			if err != nil {
+				return err
+			}
+
+			// a company that names itself as its own owner adds nothing to the graph
+			if partyID == subjectID {
+				continue
+			}
+
+			err = insertRelation(ctx, tx, c.ID, partyID, null.StringFrom(subjectID), r.role, party.Percentage, confidence)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SyncCaseGraph re-extracts the entities and relations of one case. Relations
+// of a case that is no longer validated are removed.
+func SyncCaseGraph(ctx context.Context, tx pgx.Tx, caseID string) error {
+	query := `
+	SELECT id, subject, subject_type, person_in_charge, benificiary_ownership
+	FROM cases
+	WHERE id = $1
+	AND status = $2
+	`
+
+	var c graphCaseRow
+	err := tx.QueryRow(ctx, query, caseID, validated).Scan(&c.ID, &c.Subject, &c.SubjectType, &c.PersonInCharge, &c.BenificiaryOwnership)
+
+	if err == pgx.ErrNoRows {
+		_, err = tx.Exec(ctx, `DELETE FROM entity_relations WHERE case_id = $1`, caseID)
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return syncGraphCase(ctx, tx, c)
+}
+
+// RebuildGraph resolves the case subjects into entities and re-extracts the
+// relations of every validated case, in batches keyed on the case id.
+func RebuildGraph(ctx context.Context, tx pgx.Tx) (int, error) {
+	const batchSize = 500
+
+	query := `
+	SELECT id, subject, subject_type, person_in_charge, benificiary_ownership
+	FROM cases
+	WHERE status = $1
+	AND id > $2
+	ORDER BY id ASC
+	LIMIT $3
+	`
+
+	log.Info().Msg("Start rebuilding graph")
+
+	_, err := ResolveEntities(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM entity_relations`)
+	if err != nil {
+		return 0, err
+	}
+
+	synced := 0
+	lastID := ""
+
+	for {
+		rows, err := tx.Query(ctx, query, validated, lastID, batchSize)
+		if err != nil {
+			return synced, err
+		}
+
+		// the batch is read fully before writing, the connection cannot run
+		// other statements while rows are open
+		batch, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (graphCaseRow, error) {
+			var c graphCaseRow
+			err := row.Scan(&c.ID, &c.Subject, &c.SubjectType, &c.PersonInCharge, &c.BenificiaryOwnership)
+			return c, err
+		})
+		if err != nil {
+			return synced, err
+		}
+
+		for _, c := range batch {
+			if err = syncGraphCase(ctx, tx, c); err != nil {
+				return synced, err
+			}
+			synced++
+		}
+
+		if len(batch) < batchSize {
+			break
+		}
+
+		lastID = batch[len(batch)-1].ID
+	}
+
+	// entities left without any relation belonged to cases that are gone or
+	// were merged into another entity
+	_, err = tx.Exec(ctx, `DELETE FROM entity_aliases a WHERE NOT EXISTS (SELECT 1 FROM entity_relations r WHERE r.source_entity_id = a.entity_id OR r.target_entity_id = a.entity_id)`)
+	if err != nil {
+		return synced, err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM entities e WHERE NOT EXISTS (SELECT 1 FROM entity_relations r WHERE r.source_entity_id = e.id OR r.target_entity_id = e.id)`)
+	if err != nil {
+		return synced, err
+	}
+
+	log.Info().Msgf("Finish rebuilding graph, %d cases synced", synced)
+
+	return synced, nil
+}
@@ -0,0 +1,214 @@
+package bo_v1_models
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+type RelationRole int
+
+const (
+	subjectOf RelationRole = iota + 1
+	beneficialOwner
+	personInCharge
+)
+
+func (r RelationRole) String() string {
+	return [...]string{"subject_of", "beneficial_owner", "person_in_charge"}[r-1]
+}
+
+const (
+	DefaultGraphHops = 2
+	MaxGraphHops     = 4
+	// maxGraphNodes bounds the size of a graph response, a well connected
+	// entity can otherwise pull in most of the table within a few hops.
+	maxGraphNodes = 500
+)
+
+type GraphNode struct {
+	ID     string      `json:"id"`
+	Type   string      `json:"type"`
+	Label  string      `json:"label"`
+	Nation null.String `json:"nation,omitempty"`
+	Year   null.String `json:"year,omitempty"`
+}
+
+type GraphEdge struct {
+	Source     string      `json:"source"`
+	Target     string      `json:"target"`
+	Type       string      `json:"type"`
+	Percentage null.Float  `json:"percentage"`
+	CaseID     null.String `json:"case_id"`
+}
+
+type GraphModel struct {
+	Root      string      `json:"root"`
+	Hops      int         `json:"hops"`
+	Truncated bool        `json:"truncated"`
+	Nodes     []GraphNode `json:"nodes"`
+	Edges     []GraphEdge `json:"edges"`
+}
+
+var ErrGraphRootNotFound = errors.New("graph root not found")
+
+var emptyGraphModel GraphModel
+
+// GetGraph returns the ownership network around a case or an entity, walking
+// every relation regardless of its direction up to the given number of hops.
+func GetGraph(ctx context.Context, tx pgx.Tx, rootID string, hops int) (GraphModel, error) {
+	graph := GraphModel{Root: rootID, Hops: hops}
+
+	root, err := getGraphNodes(ctx, tx, []string{rootID})
+	if err != nil {
+		return emptyGraphModel, err
+	}
+
+	if len(root) == 0 {
+		return emptyGraphModel, ErrGraphRootNotFound
+	}
+
+	visited := map[string]bool{rootID: true}
+	seenEdges := map[GraphEdge]bool{}
+	frontier := []string{rootID}
+	nodes := root
+
+	for hop := 0; hop < hops && len(frontier) > 0; hop++ {
+		edges, err := getGraphEdges(ctx, tx, frontier)
+		if err != nil {
+			return emptyGraphModel, err
+		}
+
+		var next []string
+
+		for _, edge := range edges {
+			if seenEdges[edge] {
+				continue
+			}
+
+			for _, id := range []string{edge.Source, edge.Target} {
+				if visited[id] {
+					continue
+				}
+
+				if len(visited) >= maxGraphNodes {
+					graph.Truncated = true
+					continue
+				}
+
+				visited[id] = true
+				next = append(next, id)
+			}
+
+			// an edge is only kept once both its ends are part of the graph
+			if visited[edge.Source] && visited[edge.Target] {
+				seenEdges[edge] = true
+				graph.Edges = append(graph.Edges, edge)
+			}
+		}
+
+		if len(next) > 0 {
+			found, err := getGraphNodes(ctx, tx, next)
+			if err != nil {
+				return emptyGraphModel, err
+			}
+			nodes = append(nodes, found...)
+		}
+
+		frontier = next
+	}
+
+	graph.Nodes = nodes
+
+	return graph, nil
+}
+
+// getGraphNodes loads entities and validated cases by id. Case nodes use the
+// case type as their type so they can be told apart from entities.
+func getGraphNodes(ctx context.Context, tx pgx.Tx, ids []string) ([]GraphNode, error) {
+	query := `
+	SELECT e.id, e.entity_type, e.name, NULL::text, NULL::text
+	FROM entities e
+	WHERE e.id = ANY($1)
+	UNION ALL
+	SELECT c.id, 0, c.subject, c.nation, c.year
+	FROM cases c
+	WHERE c.id = ANY($1)
+	AND c.status = $2
+	`
+
+	log.Info().Msg("Executing query: " + query)
+
+	rows, err := tx.Query(ctx, query, ids, validated)
+	if err != nil {
+		log.Error().Err(err).Msg("Error querying graph nodes")
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var nodes []GraphNode
+
+	for rows.Next() {
+		var node GraphNode
+		var entityType SubjectTypeInt
+
+		err = rows.Scan(&node.ID, &entityType, &node.Label, &node.Nation, &node.Year)
+		if err != nil {
+			return nil, err
+		}
+
+		if entityType == 0 {
+			node.Type = "case"
+		} else {
+			node.Type = entityType.String()
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes, rows.Err()
+}
+
+// getGraphEdges loads every relation touching one of the given nodes. A
+// subject_of relation points from the subject entity to its case.
+func getGraphEdges(ctx context.Context, tx pgx.Tx, ids []string) ([]GraphEdge, error) {
+	query := `
+	SELECT r.source_entity_id, COALESCE(r.target_entity_id, r.case_id), r.role, r.percentage, r.case_id
+	FROM entity_relations r
+	JOIN cases c ON c.id = r.case_id AND c.status = $2
+	WHERE r.source_entity_id = ANY($1)
+	OR r.target_entity_id = ANY($1)
+	OR (r.role = $3 AND r.case_id = ANY($1))
+	`
+
+	log.Info().Msg("Executing query: " + query)
+
+	rows, err := tx.Query(ctx, query, ids, validated, subjectOf)
+	if err != nil {
+		log.Error().Err(err).Msg("Error querying graph edges")
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var edges []GraphEdge
+
+	for rows.Next() {
+		var edge GraphEdge
+		var role RelationRole
+
+		err = rows.Scan(&edge.Source, &edge.Target, &role, &edge.Percentage, &edge.CaseID)
+		if err != nil {
+			return nil, err
+		}
+
+		edge.Type = role.String()
+		edges = append(edges, edge)
+	}
+
+	return edges, rows.Err()
+}
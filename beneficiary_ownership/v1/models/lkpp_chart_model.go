@@ -7,6 +7,7 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
 )
 
 type LkppChartsModel struct {
@@ -15,25 +16,48 @@ type LkppChartsModel struct {
 	TopTenReporters       []common_models.BaseChartModel           `json:"top_ten_reporter"`
 	ScenarioDistribution  []common_models.BaseChartModelFloatValue `json:"scenario_distribution"`
 	ViolationDistribution []common_models.BaseChartModelFloatValue `json:"violation_distribution"`
+	BlacklistPerMonth     []common_models.BaseChartModel           `json:"blacklist_per_month"`
+	// AverageSanctionDuration is the average number of days between the start
+	// and the end of the punishment per violated rule
+	AverageSanctionDuration []common_models.BaseChartModelFloatValue `json:"average_sanction_duration"`
+	// GeneratedAt is the last refresh of the aggregates the charts read
+	GeneratedAt null.Time `json:"generated_at"`
 }
 
 var emptyLkppChartModel LkppChartsModel
 
-func LkppChartData(ctx context.Context, tx pgx.Tx) (LkppChartsModel, error) {
+// lkppFilterClause restricts every LKPP chart to the requested period and
+// provinces of lkpp_case_stats, which only counts validated LKPP cases, see
+// lkppFilterArgs.
+const lkppFilterClause = `
+			($1::date IS NULL OR s.case_date >= $1::date)
+			AND ($2::date IS NULL OR s.case_date < $2::date + 1)
+			AND (cardinality($3::text[]) = 0 OR s.province = ANY($3::text[]))
+`
+
+func lkppFilterArgs(lkppChartRequest LkppChartRequest) []any {
+	return []any{lkppChartRequest.From, lkppChartRequest.To, lkppChartRequest.Provinces}
+}
+
+// LkppChartData aggregates the LKPP cases from lkpp_case_stats, as of its
+// last refresh.
+func LkppChartData(ctx context.Context, tx pgx.Tx, lkppChartRequest LkppChartRequest) (LkppChartsModel, error) {
 
 	var lkppChartsResult LkppChartsModel
 
+	lkppChartRequest = lkppChartRequest.orDefault()
+	args := lkppFilterArgs(lkppChartRequest)
+
 	// Get Blacklist by Province Chart Data
 	blacklistProvincesQuery := `
 		SELECT
-			c.extra_data -> 0 -> 'data' ->> 'province' dimension,
-			count(c.extra_data -> 0 -> 'data' ->> 'province') total
+			s.province dimension,
+			sum(s.total)::bigint total
 		FROM
-			cases c
-		WHERE
-			c.extra_data -> 0 ->> 'type' = 'LKPP'
-			AND c.extra_data -> 0 -> 'data' ->> 'province' <> ''
-			AND c.extra_data -> 0 -> 'data' ->> 'province' <> '-'
+			` + lkppCaseStats + ` s
+		WHERE` + lkppFilterClause + `
+			AND s.province <> ''
+			AND s.province <> '-'
 		GROUP BY
 			1
 		ORDER BY
@@ -41,7 +65,7 @@ func LkppChartData(ctx context.Context, tx pgx.Tx) (LkppChartsModel, error) {
 	`
 	log.Info().Msg("Executing query: " + blacklistProvincesQuery)
 
-	blacklistProvinces, err := tx.Query(ctx, blacklistProvincesQuery)
+	blacklistProvinces, err := tx.Query(ctx, blacklistProvincesQuery, args...)
 
 	log.Info().Msg("Blacklist by Province Chart Data query executed")
 
@@ -64,38 +88,23 @@ func LkppChartData(ctx context.Context, tx pgx.Tx) (LkppChartsModel, error) {
 		lkppChartsResult.BlacklistProvinces = append(lkppChartsResult.BlacklistProvinces, chartResult)
 	}
 
-	// Get Ceiling Distribution Chart Data
+	// Get Ceiling Distribution Chart Data, a ceiling equal to the last bound
+	// stays in the bucket below it as in "50 B - 100 B"
 	ceilingDistributionQuery := `
 		SELECT
-			a.*
-		FROM (
-			SELECT
-			CASE
-				WHEN (c.extra_data -> 0 -> 'data' ->> 'ceiling')::bigint >= 0 AND (c.extra_data -> 0 -> 'data' ->> 'ceiling')::bigint < 2500000000 THEN '0 - 2.5 B'
-				WHEN (c.extra_data -> 0 -> 'data' ->> 'ceiling')::bigint >= 2500000000 AND (c.extra_data -> 0 -> 'data' ->> 'ceiling')::bigint < 15000000000 THEN '2.5 B - 15 B'
-				WHEN (c.extra_data -> 0 -> 'data' ->> 'ceiling')::bigint >= 15000000000 AND (c.extra_data -> 0 -> 'data' ->> 'ceiling')::bigint < 50000000000 THEN '15 B - 50 B'
-				WHEN (c.extra_data -> 0 -> 'data' ->> 'ceiling')::bigint >= 50000000000 AND (c.extra_data -> 0 -> 'data' ->> 'ceiling')::bigint <= 100000000000 THEN '50 B - 100 B'
-				WHEN (c.extra_data -> 0 -> 'data' ->> 'ceiling')::bigint > 100000000000 THEN '> 100 B'
-			END AS dimension,
-			COUNT(*) AS value
-			FROM
-				cases c
-			WHERE
-				c.extra_data -> 0 ->> 'type' = 'LKPP'
-			GROUP BY dimension
-		) a
+			width_bucket(s.ceiling, $4::bigint[]) - (s.ceiling = ($4::bigint[])[cardinality($4::bigint[])])::int AS bucket,
+			sum(s.total)::bigint AS value
+		FROM
+			` + lkppCaseStats + ` s
+		WHERE` + lkppFilterClause + `
+		GROUP BY
+			1
 		ORDER BY
-			CASE
-				WHEN a.dimension = '0 - 2.5 B' THEN 1
-				WHEN a.dimension = '2.5 B - 15 B' THEN 2
-				WHEN a.dimension = '15 B - 50 B' THEN 3
-				WHEN a.dimension = '50 B - 100 B' THEN 4
-				WHEN a.dimension = '> 100 B' THEN 5
-			END ASC;
+			1 ASC;
 	`
 	log.Info().Msg("Executing query: " + ceilingDistributionQuery)
 
-	ceilingDistributions, err := tx.Query(ctx, ceilingDistributionQuery)
+	ceilingDistributions, err := tx.Query(ctx, ceilingDistributionQuery, append(args, lkppChartRequest.CeilingBuckets)...)
 
 	log.Info().Msg("Ceiling Distribution Chart Data query executed")
 
@@ -106,36 +115,43 @@ func LkppChartData(ctx context.Context, tx pgx.Tx) (LkppChartsModel, error) {
 
 	defer ceilingDistributions.Close()
 
+	ceilingLabels := ceilingBucketLabels(lkppChartRequest.CeilingBuckets)
+
 	for ceilingDistributions.Next() {
 		var chartResult common_models.BaseChartModel
+		var bucket null.Int
 
-		err = ceilingDistributions.Scan(&chartResult.Name, &chartResult.Value)
+		err = ceilingDistributions.Scan(&bucket, &chartResult.Value)
 
 		if err != nil {
 			return emptyLkppChartModel, err
 		}
 
+		// cases without a ceiling keep an empty name
+		if bucket.Valid {
+			chartResult.Name = null.StringFrom(ceilingLabels[bucket.Int64])
+		}
+
 		lkppChartsResult.CeilingDistribution = append(lkppChartsResult.CeilingDistribution, chartResult)
 	}
 
 	// Get Top Ten Reporters Chart Data
 	topTenReportersQuery := `
 		SELECT
-			c.extra_data -> 0 -> 'data' ->> 'institution_area' AS dimension,
-			count(*) total_report
+			s.institution_area AS dimension,
+			sum(s.total)::bigint total_report
 		FROM
-			cases c
-		WHERE
-			c.extra_data -> 0 ->> 'type' = 'LKPP'
+			` + lkppCaseStats + ` s
+		WHERE` + lkppFilterClause + `
 		GROUP BY
 			1
 		ORDER BY
 			2 DESC
-		LIMIT 10;
+		LIMIT $4;
 	`
 	log.Info().Msg("Executing query: " + topTenReportersQuery)
 
-	topTenReporters, err := tx.Query(ctx, topTenReportersQuery)
+	topTenReporters, err := tx.Query(ctx, topTenReportersQuery, append(args, lkppChartRequest.TopReporters)...)
 
 	log.Info().Msg("Top Ten Reporters Chart Data query executed")
 
@@ -161,12 +177,11 @@ func LkppChartData(ctx context.Context, tx pgx.Tx) (LkppChartsModel, error) {
 	// Get Blacklist Distribution by Scenario Chart Data
 	scenarioDistributionQuery := `
 		SELECT
-			c.extra_data -> 0 -> 'data' ->> 'scenario' AS dimension,
-			round(count(*)::decimal / sum(count(*)) OVER (), 3)*100 AS percentage
+			s.scenario AS dimension,
+			round(sum(s.total)::decimal / sum(sum(s.total)) OVER (), 3)*100 AS percentage
 		FROM
-			cases c
-		WHERE
-			c.extra_data -> 0 ->> 'type' = 'LKPP'
+			` + lkppCaseStats + ` s
+		WHERE` + lkppFilterClause + `
 		GROUP BY
 			1
 		ORDER BY
@@ -174,7 +189,7 @@ func LkppChartData(ctx context.Context, tx pgx.Tx) (LkppChartsModel, error) {
 	`
 	log.Info().Msg("Executing query: " + scenarioDistributionQuery)
 
-	scenarioDistribution, err := tx.Query(ctx, scenarioDistributionQuery)
+	scenarioDistribution, err := tx.Query(ctx, scenarioDistributionQuery, args...)
 
 	log.Info().Msg("Blacklist Distribution by Scenario Chart Data query executed")
 
@@ -201,20 +216,19 @@ func LkppChartData(ctx context.Context, tx pgx.Tx) (LkppChartsModel, error) {
 	violationDistributionQuery := `
 		WITH ranked AS (
 			SELECT
-				c.extra_data -> 0 -> 'data' ->> 'rule' AS dimension,
-				count(*) AS total,
-				rank() OVER (ORDER BY count(*) desc) AS rnk
+				s.rule AS dimension,
+				sum(s.total) AS total,
+				rank() OVER (ORDER BY sum(s.total) desc) AS rnk
 			FROM
-				cases c
-			WHERE
-				c.extra_data -> 0 ->> 'type' = 'LKPP'
+				` + lkppCaseStats + ` s
+			WHERE` + lkppFilterClause + `
 			GROUP BY
 				1
 		),
 		dimensions AS (
 			SELECT
 				CASE
-					WHEN rnk <= 5 THEN dimension
+					WHEN rnk <= $4 THEN dimension
 					ELSE 'Other'
 				END AS dimension,
 				sum(total) AS total
@@ -244,7 +258,7 @@ func LkppChartData(ctx context.Context, tx pgx.Tx) (LkppChartsModel, error) {
 	`
 	log.Info().Msg("Executing query: " + violationDistributionQuery)
 
-	violationDistribution, err := tx.Query(ctx, violationDistributionQuery)
+	violationDistribution, err := tx.Query(ctx, violationDistributionQuery, append(args, lkppChartRequest.TopViolations)...)
 
 	log.Info().Msg("Distribution of Violation Chart Data query executed")
 
@@ -267,5 +281,88 @@ func LkppChartData(ctx context.Context, tx pgx.Tx) (LkppChartsModel, error) {
 		lkppChartsResult.ViolationDistribution = append(lkppChartsResult.ViolationDistribution, chartResult)
 	}
 
+	// Get Blacklist per Month Chart Data
+	blacklistPerMonthQuery := `
+		SELECT
+			to_char(date_trunc('month', s.case_date), 'YYYY-MM') AS dimension,
+			sum(s.total)::bigint AS total
+		FROM
+			` + lkppCaseStats + ` s
+		WHERE` + lkppFilterClause + `
+			AND s.case_date IS NOT NULL
+		GROUP BY
+			1
+		ORDER BY
+			1 ASC;
+	`
+	log.Info().Msg("Executing query: " + blacklistPerMonthQuery)
+
+	blacklistPerMonth, err := tx.Query(ctx, blacklistPerMonthQuery, args...)
+
+	log.Info().Msg("Blacklist per Month Chart Data query executed")
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error querying Blacklist per Month Chart Data")
+		return emptyLkppChartModel, err
+	}
+
+	defer blacklistPerMonth.Close()
+
+	for blacklistPerMonth.Next() {
+		var chartResult common_models.BaseChartModel
+
+		err = blacklistPerMonth.Scan(&chartResult.Name, &chartResult.Value)
+
+		if err != nil {
+			return emptyLkppChartModel, err
+		}
+
+		lkppChartsResult.BlacklistPerMonth = append(lkppChartsResult.BlacklistPerMonth, chartResult)
+	}
+
+	// Get Average Sanction Duration per Rule Chart Data
+	averageSanctionDurationQuery := `
+		SELECT
+			s.rule AS dimension,
+			round(sum(s.sanction_days) / sum(s.sanctioned), 1) AS days
+		FROM
+			` + lkppCaseStats + ` s
+		WHERE` + lkppFilterClause + `
+			AND s.sanctioned > 0
+		GROUP BY
+			1
+		ORDER BY
+			2 DESC;
+	`
+	log.Info().Msg("Executing query: " + averageSanctionDurationQuery)
+
+	averageSanctionDuration, err := tx.Query(ctx, averageSanctionDurationQuery, args...)
+
+	log.Info().Msg("Average Sanction Duration per Rule Chart Data query executed")
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error querying Average Sanction Duration per Rule Chart Data")
+		return emptyLkppChartModel, err
+	}
+
+	defer averageSanctionDuration.Close()
+
+	for averageSanctionDuration.Next() {
+		var chartResult common_models.BaseChartModelFloatValue
+
+		err = averageSanctionDuration.Scan(&chartResult.Name, &chartResult.Value)
+
+		if err != nil {
+			return emptyLkppChartModel, err
+		}
+
+		lkppChartsResult.AverageSanctionDuration = append(lkppChartsResult.AverageSanctionDuration, chartResult)
+	}
+
+	lkppChartsResult.GeneratedAt, err = aggregateRefreshedAt(ctx, tx, lkppCaseStats)
+	if err != nil {
+		return emptyLkppChartModel, err
+	}
+
 	return lkppChartsResult, nil
 }
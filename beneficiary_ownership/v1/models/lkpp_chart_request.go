@@ -0,0 +1,97 @@
+package bo_v1_models
+
+import (
+	"errors"
+	"strconv"
+
+	"gopkg.in/guregu/null.v4"
+)
+
+const (
+	DefaultLkppTopReporters  = 10
+	DefaultLkppTopViolations = 5
+	MaxLkppTop               = 50
+)
+
+// DefaultLkppCeilingBuckets are the lower bounds, in rupiah, of the ceiling
+// buckets after the first one which always starts at 0. The last bound is the
+// exception, it is the inclusive upper bound of the bucket below it.
+var DefaultLkppCeilingBuckets = []int64{2500000000, 15000000000, 50000000000, 100000000000}
+
+// LkppChartRequest narrows the LKPP charts to a period and to provinces. From
+// and To are inclusive and compared with the case date.
+type LkppChartRequest struct {
+	From           null.Time
+	To             null.Time
+	Provinces      []string
+	CeilingBuckets []int64
+	TopReporters   int
+	TopViolations  int
+}
+
+func (l LkppChartRequest) Validate() error {
+	if l.From.Valid && l.To.Valid && l.From.Time.After(l.To.Time) {
+		return errors.New("from must not be after to")
+	}
+
+	for i, bound := range l.CeilingBuckets {
+		if bound <= 0 || i > 0 && bound <= l.CeilingBuckets[i-1] {
+			return errors.New("buckets must be positive and ascending")
+		}
+	}
+
+	if l.TopReporters < 0 || l.TopReporters > MaxLkppTop || l.TopViolations < 0 || l.TopViolations > MaxLkppTop {
+		return errors.New("top must be between 1 and " + strconv.Itoa(MaxLkppTop))
+	}
+
+	return nil
+}
+
+func (l LkppChartRequest) orDefault() LkppChartRequest {
+	if len(l.CeilingBuckets) == 0 {
+		l.CeilingBuckets = DefaultLkppCeilingBuckets
+	}
+
+	if l.TopReporters == 0 {
+		l.TopReporters = DefaultLkppTopReporters
+	}
+
+	if l.TopViolations == 0 {
+		l.TopViolations = DefaultLkppTopViolations
+	}
+
+	if l.Provinces == nil {
+		l.Provinces = []string{}
+	}
+
+	return l
+}
+
+// ceilingBucketLabels names the buckets numbered by width_bucket over the
+// bounds, bucket 0 is below the first bound and the last is above the last.
+func ceilingBucketLabels(bounds []int64) []string {
+	labels := make([]string, 0, len(bounds)+1)
+	lower := "0"
+
+	for _, bound := range bounds {
+		labels = append(labels, lower+" - "+formatRupiah(bound))
+		lower = formatRupiah(bound)
+	}
+
+	return append(labels, "> "+lower)
+}
+
+// formatRupiah shortens an amount the way the charts label it, 2500000000
+// becomes "2.5 B".
+func formatRupiah(amount int64) string {
+	switch {
+	case amount >= 1000000000000:
+		return strconv.FormatFloat(float64(amount)/1000000000000, 'f', -1, 64) + " T"
+	case amount >= 1000000000:
+		return strconv.FormatFloat(float64(amount)/1000000000, 'f', -1, 64) + " B"
+	case amount >= 1000000:
+		return strconv.FormatFloat(float64(amount)/1000000, 'f', -1, 64) + " M"
+	default:
+		return strconv.FormatInt(amount, 10)
+	}
+}
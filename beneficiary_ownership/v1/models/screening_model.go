@@ -0,0 +1,243 @@
+package bo_v1_models
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MaxScreeningInputs        = 500
+	DefaultScreeningLimit     = 5
+	MaxScreeningLimit         = 20
+	screeningIdentifierWeight = 0.1
+)
+
+type ScreeningInput struct {
+	Reference          string `json:"reference"`
+	Name               string `json:"name"`
+	SubjectType        string `json:"subject_type"`
+	Nation             string `json:"nation"`
+	DateOfBirth        string `json:"date_of_birth"`
+	RegistrationNumber string `json:"registration_number"`
+}
+
+// ScreeningRequest is a batch of names to screen. A Limit left out or 0 is
+// DefaultScreeningLimit.
+type ScreeningRequest struct {
+	Inputs   []ScreeningInput `json:"inputs"`
+	MinScore float64          `json:"min_score"`
+	Limit    int              `json:"limit"`
+}
+
+type ScreeningCandidate struct {
+	SearchResultModel
+	MatchedName  string   `json:"matched_name"`
+	MatchedField string   `json:"matched_field"`
+	Explanations []string `json:"explanations"`
+}
+
+type ScreeningResult struct {
+	Input      ScreeningInput       `json:"input"`
+	Candidates []ScreeningCandidate `json:"candidates"`
+	Error      string               `json:"error,omitempty"`
+}
+
+// ScreenNames matches every input against the validated cases with the fuzzy
+// search and explains each candidate: which name of the case matched and
+// whether the date of birth or registration number of the input appears in
+// the case summary. Found identifiers raise the score of a candidate. An input
+// that fails is reported with its error and the others are still screened.
+func ScreenNames(ctx context.Context, tx pgx.Tx, screeningRequest ScreeningRequest) ([]ScreeningResult, error) {
+	limit := screeningRequest.Limit
+	if limit <= 0 {
+		limit = DefaultScreeningLimit
+	}
+
+	results := make([]ScreeningResult, 0, len(screeningRequest.Inputs))
+
+	for _, input := range screeningRequest.Inputs {
+		result, err := screenInput(ctx, tx, input, screeningRequest.MinScore, limit)
+		if err != nil {
+			log.Error().Err(err).Str("reference", input.Reference).Msg("Error screening name")
+			result = ScreeningResult{Input: input, Candidates: []ScreeningCandidate{}, Error: "screening failed"}
+		}
+
+		results = append(results, result)
+	}
+
+	log.Info().Msgf("Screened %d names", len(results))
+
+	return results, nil
+}
+
+// screenInput screens one input in a savepoint, so that a failed query does
+// not abort the transaction of the whole batch.
+func screenInput(ctx context.Context, tx pgx.Tx, input ScreeningInput, minScore float64, limit int) (ScreeningResult, error) {
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return ScreeningResult{}, err
+	}
+
+	defer savepoint.Rollback(ctx)
+
+	searchRequest := SearchRequest{
+		Query:    input.Name,
+		Match:    matchFuzzy,
+		MinScore: minScore,
+		PerPage:  int64(limit),
+		Sort:     DefaultSearchSort,
+		// a cursor at the start skips the count query
+		Cursor: &SearchCursor{},
+	}
+
+	if input.SubjectType != "" {
+		searchRequest.SubjectTypes = []string{input.SubjectType}
+	}
+
+	// the nation filter is a pattern, the nation of the input is matched as
+	// written, "Korea (South)" included
+	if input.Nation != "" {
+		searchRequest.Nations = []string{regexp.QuoteMeta(input.Nation)}
+	}
+
+	response, err := SearchByRequest(ctx, savepoint, searchRequest)
+	if err != nil {
+		return ScreeningResult{}, err
+	}
+
+	hits, _ := response.Data.([]SearchResultModel)
+
+	summaries, err := getCaseSummaries(ctx, savepoint, hits)
+	if err != nil {
+		return ScreeningResult{}, err
+	}
+
+	result := ScreeningResult{Input: input, Candidates: []ScreeningCandidate{}}
+
+	for _, hit := range hits {
+		result.Candidates = append(result.Candidates, explainCandidate(input, hit, summaries[hit.ID.String()]))
+	}
+
+	sort.SliceStable(result.Candidates, func(i, j int) bool {
+		return result.Candidates[i].Score.Float64 > result.Candidates[j].Score.Float64
+	})
+
+	return result, savepoint.Commit(ctx)
+}
+
+func getCaseSummaries(ctx context.Context, tx pgx.Tx, hits []SearchResultModel) (map[string]string, error) {
+	summaries := map[string]string{}
+
+	if len(hits) == 0 {
+		return summaries, nil
+	}
+
+	ids := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID.String())
+	}
+
+	rows, err := tx.Query(ctx, `SELECT id, summary FROM cases WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, summary string
+		if err = rows.Scan(&id, &summary); err != nil {
+			return nil, err
+		}
+		summaries[id] = summary
+	}
+
+	return summaries, rows.Err()
+}
+
+type screeningName struct {
+	field string
+	name  string
+}
+
+// explainCandidate finds the name of the case closest to the screened name
+// and checks the identifiers of the input against the case summary.
+func explainCandidate(input ScreeningInput, hit SearchResultModel, summary string) ScreeningCandidate {
+	candidate := ScreeningCandidate{SearchResultModel: hit}
+
+	names := []screeningName{{"subject", hit.Subject}}
+
+	for _, party := range ParseParties(hit.BenificiaryOwnership.String) {
+		names = append(names, screeningName{"benificiary_ownership", party.Name})
+	}
+
+	for _, party := range ParseParties(hit.PersonInCharge.String) {
+		names = append(names, screeningName{"person_in_charge", party.Name})
+	}
+
+	screened := normalizeEntityName(FoldName(input.Name))
+	best := -1.0
+
+	for _, n := range names {
+		similarity := entitySimilarity(screened, normalizeEntityName(FoldName(n.name)))
+		if similarity > best {
+			best = similarity
+			candidate.MatchedName = n.name
+			candidate.MatchedField = n.field
+		}
+	}
+
+	candidate.Explanations = append(candidate.Explanations, fmt.Sprintf("name matches %s %q with similarity %.2f", candidate.MatchedField, candidate.MatchedName, hit.Score.Float64))
+
+	if input.Nation != "" {
+		candidate.Explanations = append(candidate.Explanations, fmt.Sprintf("nation matches %q", hit.Nation))
+	}
+
+	score := hit.Score.Float64
+	lowerSummary := strings.ToLower(summary)
+
+	if input.RegistrationNumber != "" && strings.Contains(lowerSummary, strings.ToLower(input.RegistrationNumber)) {
+		score += screeningIdentifierWeight
+		candidate.Explanations = append(candidate.Explanations, fmt.Sprintf("registration number %q appears in the case summary", input.RegistrationNumber))
+	}
+
+	if input.DateOfBirth != "" {
+		if found, ok := findDateInText(input.DateOfBirth, lowerSummary); ok {
+			score += screeningIdentifierWeight
+			candidate.Explanations = append(candidate.Explanations, fmt.Sprintf("date of birth appears in the case summary as %q", found))
+		}
+	}
+
+	if score > 1 {
+		score = 1
+	}
+	candidate.Score.Float64 = score
+
+	return candidate
+}
+
+var dateOfBirthLayouts = []string{"2006-01-02", "02-01-2006", "02/01/2006", "2 January 2006", "02 January 2006", "2 Jan 2006"}
+
+// findDateInText looks for an ISO date written in any of the common layouts.
+func findDateInText(isoDate string, lowerText string) (string, bool) {
+	date, err := time.Parse("2006-01-02", isoDate)
+	if err != nil {
+		return "", false
+	}
+
+	for _, layout := range dateOfBirthLayouts {
+		formatted := date.Format(layout)
+		if strings.Contains(lowerText, strings.ToLower(formatted)) {
+			return formatted, true
+		}
+	}
+
+	return "", false
+}
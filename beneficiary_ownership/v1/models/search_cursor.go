@@ -0,0 +1,56 @@
+package bo_v1_models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// SearchCursor points at the last row of a search page. The next page starts
+// right after the row with this sort key and id. The key is kept in its text
+// form so Postgres parses it back into the type of the sort column.
+type SearchCursor struct {
+	Sort string    `json:"s"`
+	Key  string    `json:"k"`
+	ID   ulid.ULID `json:"id"`
+}
+
+var errInvalidCursor = errors.New("cursor is invalid")
+
+// IsStart reports whether the cursor points at the beginning of the result set.
+func (c SearchCursor) IsStart() bool {
+	return c.ID == (ulid.ULID{})
+}
+
+// Encode returns the opaque string representation of the cursor.
+func (c SearchCursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeSearchCursor parses a cursor previously returned as next_cursor.
+// An empty string is the start of the result set.
+func DecodeSearchCursor(s string) (SearchCursor, error) {
+	var cursor SearchCursor
+
+	if s == "" {
+		return cursor, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, errInvalidCursor
+	}
+
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return cursor, errInvalidCursor
+	}
+
+	if cursor.IsStart() {
+		return cursor, errInvalidCursor
+	}
+
+	return cursor, nil
+}
@@ -0,0 +1,112 @@
+package bo_v1_models
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	common_models "lexicon/bo-api/common/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+// searchFacetColumns maps every facet to the column it counts.
+var searchFacetColumns = map[string]string{
+	"nation":       "nation",
+	"subject_type": "subject_type::text",
+	"case_type":    "case_type::text",
+	"year":         "year",
+}
+
+// IsSearchFacet reports whether a facet can be requested.
+func IsSearchFacet(facet string) bool {
+	_, ok := searchFacetColumns[facet]
+	return ok
+}
+
+// SearchFacets counts the rows matching the search request by each requested
+// facet, using the same filter as SearchByRequest.
+func SearchFacets(ctx context.Context, tx pgx.Tx, searchRequest SearchRequest) (map[string][]common_models.BaseChartModel, error) {
+	facets := map[string][]common_models.BaseChartModel{}
+
+	if len(searchRequest.Facets) == 0 {
+		return facets, nil
+	}
+
+	if err := applyFuzzyThreshold(ctx, tx, searchRequest); err != nil {
+		return nil, err
+	}
+
+	var sets []string
+	for i, facet := range searchRequest.Facets {
+		sets = append(sets, "SELECT "+strconv.Itoa(i)+" AS facet, "+searchFacetColumns[facet]+" AS name FROM matched")
+	}
+
+	// the filter is evaluated once and every facet groups the matched rows
+	facetQuery := `
+	WITH matched AS MATERIALIZED (
+		SELECT nation, subject_type, case_type, year FROM cases ` + searchWhereClause(searchRequest) + `
+	)
+	SELECT facet, name, count(*) AS value FROM (
+		` + strings.Join(sets, "\n\t\tUNION ALL\n\t\t") + `
+	) f
+	GROUP BY facet, name
+	ORDER BY facet ASC, value DESC, name ASC
+	`
+
+	log.Info().Msg("Executing query: " + facetQuery)
+
+	rows, err := tx.Query(ctx, facetQuery, searchFilterArgs(searchRequest)...)
+	if err != nil {
+		log.Error().Err(err).Msg("Error querying search facets")
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for _, facet := range searchRequest.Facets {
+		facets[facet] = []common_models.BaseChartModel{}
+	}
+
+	for rows.Next() {
+		var index int
+		var chartResult common_models.BaseChartModel
+
+		if err = rows.Scan(&index, &chartResult.Name, &chartResult.Value); err != nil {
+			return nil, err
+		}
+
+		facet := searchRequest.Facets[index]
+		chartResult.Name = facetLabel(facet, chartResult.Name)
+		facets[facet] = append(facets[facet], chartResult)
+	}
+
+	return facets, rows.Err()
+}
+
+// facetLabel turns the stored value of subject and case types into their names.
+func facetLabel(facet string, value null.String) null.String {
+	if !value.Valid {
+		return value
+	}
+
+	n, err := strconv.Atoi(value.String)
+	if err != nil {
+		return value
+	}
+
+	switch facet {
+	case "subject_type":
+		if n >= int(individual) && n <= int(organization) {
+			return null.StringFrom(SubjectTypeInt(n).String())
+		}
+	case "case_type":
+		if n >= int(verdict) && n <= int(sanction) {
+			return null.StringFrom(CaseType(n).String())
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,102 @@
+package bo_v1_models
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	matchExact = "exact"
+	matchFuzzy = "fuzzy"
+
+	DefaultFuzzyMinScore = 0.3
+)
+
+// nameTransliterations fold the pre-1972 Indonesian spelling and common
+// romanization variants onto one form, so "Soekarno" matches "Sukarno" and
+// "Djojo" matches "Joyo". They are applied in order, both to the query in Go
+// and to the columns in SQL, so the two sides must stay in sync.
+var nameTransliterations = [][2]string{
+	{"oe", "u"},
+	{"dj", "j"},
+	{"tj", "c"},
+	{"ch", "h"},
+	{"kh", "h"},
+	{"y", "j"},
+}
+
+var stripAccents = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// FoldName lowercases a name, strips its accents and applies the
+// transliterations, the same way foldNameSQL does in the database.
+func FoldName(name string) string {
+	folded, _, err := transform.String(stripAccents, strings.ToLower(name))
+	if err != nil {
+		folded = strings.ToLower(name)
+	}
+
+	for _, t := range nameTransliterations {
+		folded = strings.ReplaceAll(folded, t[0], t[1])
+	}
+
+	return strings.TrimSpace(folded)
+}
+
+// foldNameSQL is the SQL counterpart of FoldName for a column or expression.
+// The trigram indexes of the fuzzy search migration are built on exactly these
+// expressions, immutable_unaccent wraps unaccent so it can be indexed.
+func foldNameSQL(expr string) string {
+	folded := "lower(immutable_unaccent(" + expr + "))"
+
+	for _, t := range nameTransliterations {
+		folded = "replace(" + folded + ", '" + t[0] + "', '" + t[1] + "')"
+	}
+
+	return folded
+}
+
+// fuzzyMatchClause matches the folded query in $1 against the subject and the
+// parties named in the case, using the pg_trgm operators so a trigram index on
+// the folded columns can be used.
+func fuzzyMatchClause() string {
+	return "(" + foldNameSQL("subject") + " % $1" +
+		" OR $1 <% " + foldNameSQL("COALESCE(benificiary_ownership, '')") +
+		" OR $1 <% " + foldNameSQL("COALESCE(person_in_charge, '')") + ")"
+}
+
+// fuzzyScoreColumn is the similarity of the best matching name of a case.
+func fuzzyScoreColumn() string {
+	return "GREATEST(similarity(" + foldNameSQL("subject") + ", $1)" +
+		", word_similarity($1, " + foldNameSQL("COALESCE(benificiary_ownership, '')") + ")" +
+		", word_similarity($1, " + foldNameSQL("COALESCE(person_in_charge, '')") + "))::float8"
+}
+
+func (s SearchRequest) isFuzzy() bool {
+	return s.Match == matchFuzzy && s.Query != ""
+}
+
+// applyFuzzyThreshold sets the pg_trgm thresholds used by the % and <%
+// operators for the rest of the transaction.
+func applyFuzzyThreshold(ctx context.Context, tx pgx.Tx, searchRequest SearchRequest) error {
+	if !searchRequest.isFuzzy() {
+		return nil
+	}
+
+	minScore := searchRequest.MinScore
+	if minScore <= 0 {
+		minScore = DefaultFuzzyMinScore
+	}
+
+	threshold := strconv.FormatFloat(minScore, 'f', -1, 64)
+
+	_, err := tx.Exec(ctx, `SELECT set_config('pg_trgm.similarity_threshold', $1, true), set_config('pg_trgm.word_similarity_threshold', $1, true)`, threshold)
+
+	return err
+}
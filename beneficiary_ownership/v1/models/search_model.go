@@ -2,6 +2,7 @@ package bo_v1_models
 
 import (
 	"context"
+	"fmt"
 	commonModels "lexicon/bo-api/common/models"
 	"math"
 	"strings"
@@ -22,6 +23,8 @@ type SearchResultModel struct {
 	Nation               string      `json:"nation"`
 	Type                 string      `json:"type"`
 	Year                 string      `json:"year"`
+	EntityID             null.String `json:"entity_id"`
+	Score                null.Float  `json:"score"`
 }
 
 type tempSearchResult struct {
@@ -33,81 +36,92 @@ type tempSearchResult struct {
 	Nation               string
 	Type                 CaseType
 	Year                 string
+	EntityID             null.String
+	Score                null.Float
 }
 
+// subjectEntityColumn selects the resolved entity a row of cases is about, so
+// hits of the same entity can be collapsed by the client.
+var subjectEntityColumn = fmt.Sprintf(`(SELECT s.source_entity_id FROM entity_relations s WHERE s.case_id = cases.id AND s.role = %d LIMIT 1)`, subjectOf)
+
 var emptyBaseModel commonModels.BasePaginationResponse
 
 func SearchByRequest(ctx context.Context, tx pgx.Tx, searchRequest SearchRequest) (commonModels.BasePaginationResponse, error) {
 	var itemCount int
 
-	limit := 20
-	offset := (int(searchRequest.Page) - 1) * limit
-	log.Info().Msg("Start counting query")
-	countQuery := `
-	SELECT COUNT(id) as cnt
-	FROM cases
-	`
-	if searchRequest.Query != "" {
-		countQuery += "WHERE fulltext_search_index @@ phraseto_tsquery('english',$1)"
-	} else {
-		countQuery += "WHERE $1 = $1"
+	limit := int(searchRequest.PerPage)
+	if limit <= 0 {
+		limit = DefaultSearchPerPage
 	}
+	offset := (int(searchRequest.Page) - 1) * limit
 
-	countQuery += `
-	AND subject_type = ANY($2::int[])
-	AND year ~* $3
-	AND case_type = ANY($4::int[])
-	AND nation ~* $5
-	AND status = $6
-	`
-	log.Info().Msg("Executing query: " + countQuery)
+	sort := searchRequest.Sort.orDefault()
 
-	row := tx.QueryRow(ctx, countQuery, searchRequest.Query, normalizeSubjectTypes(searchRequest.SubjectTypes), normalizeYears(searchRequest.Years), normalizeCaseTypes(searchRequest.Types), normalizeNations(searchRequest.Nations), validated)
-	err := row.Scan(&itemCount)
-	log.Info().Msg("Finish counting query")
+	// cursor mode skips the count and pages by the last seen sort key and id
+	// instead of an offset
+	useCursor := searchRequest.Cursor != nil
 
-	if err != nil {
-		return emptyBaseModel, err
+	if useCursor {
+		offset = 0
 	}
 
-	if itemCount == 0 {
-		return emptyBaseModel, nil
+	filterArgs := searchFilterArgs(searchRequest)
+
+	if err := applyFuzzyThreshold(ctx, tx, searchRequest); err != nil {
+		return emptyBaseModel, err
 	}
 
-	log.Info().Msg("Start searching query")
-	searchQuery := `SELECT id, subject, subject_type, person_in_charge, benificiary_ownership, nation, case_type, year`
+	if !useCursor {
+		log.Info().Msg("Start counting query")
+		countQuery := "SELECT COUNT(id) as cnt FROM cases " + searchWhereClause(searchRequest)
+		log.Info().Msg("Executing query: " + countQuery)
 
-	if searchRequest.Query != "" {
-		searchQuery += ", ts_rank_cd(fulltext_search_index, phraseto_tsquery('english', $1), 32 /* rank/(rank+1) */ ) AS rank "
-	} else {
-		searchQuery += ", 0 AS rank "
-	}
+		row := tx.QueryRow(ctx, countQuery, filterArgs...)
+		err := row.Scan(&itemCount)
+		log.Info().Msg("Finish counting query")
 
-	searchQuery += " FROM cases "
+		if err != nil {
+			return emptyBaseModel, err
+		}
 
-	if searchRequest.Query != "" {
-		searchQuery += "WHERE fulltext_search_index @@ phraseto_tsquery('english', $1)"
-	} else {
-		searchQuery += "WHERE $1 = $1 "
+		if itemCount == 0 {
+			return emptyBaseModel, nil
+		}
 	}
 
-	searchQuery += `
-	AND subject_type = ANY($2::int[])
-	AND year ~* $3
-	AND case_type = ANY($4::int[])
-	AND nation ~* $5
-	AND status = $6
+	log.Info().Msg("Start searching query")
+	scoreColumn := "NULL::float8"
+	if searchRequest.isFuzzy() {
+		scoreColumn = fuzzyScoreColumn()
+	}
+
+	searchQuery := `SELECT id, subject, subject_type, person_in_charge, benificiary_ownership, nation, case_type, year, entity_id, score, sort_key::text FROM (
+	SELECT id, subject, subject_type, person_in_charge, benificiary_ownership, nation, case_type, year, ` + subjectEntityColumn + ` AS entity_id, ` + scoreColumn + ` AS score, ` + sort.key(searchRequest) + ` AS sort_key`
+
+	searchQuery += " FROM cases " + searchWhereClause(searchRequest) + `
+	) c
 	`
 
-	if searchRequest.Query != "" {
-		searchQuery += "ORDER BY rank DESC"
+	// fetch one extra row to know whether there is a next page
+	args := append(filterArgs, limit+1, offset)
+
+	direction, comparison := "ASC", ">"
+	if sort.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if useCursor && !searchRequest.Cursor.IsStart() {
+		searchQuery += "WHERE (sort_key " + comparison + " $9 OR (sort_key = $9 AND id > $10)) "
+		args = append(args, searchRequest.Cursor.Key, searchRequest.Cursor.ID.String())
 	}
 
+	searchQuery += "ORDER BY sort_key " + direction + ", id ASC"
+
 	searchQuery += " LIMIT $7 OFFSET $8 "
 
 	log.Info().Msg("Executing query: " + searchQuery)
 
-	rows, err := tx.Query(ctx, searchQuery, searchRequest.Query, normalizeSubjectTypes(searchRequest.SubjectTypes), normalizeYears(searchRequest.Years), normalizeCaseTypes(searchRequest.Types), normalizeNations(searchRequest.Nations), validated, limit, offset)
+	rows, err := tx.Query(ctx, searchQuery, args...)
 
 	log.Info().Msg("Finish searching query")
 	if err != nil {
@@ -118,15 +132,23 @@ func SearchByRequest(ctx context.Context, tx pgx.Tx, searchRequest SearchRequest
 	defer rows.Close()
 
 	var searchResults []SearchResultModel
+	var nextCursor SearchCursor
+	hasMore := false
 
 	for rows.Next() {
-		var rank float64
+		if len(searchResults) == limit {
+			hasMore = true
+			break
+		}
+
+		var key string
 		var tempResult tempSearchResult
-		err = rows.Scan(&tempResult.ID, &tempResult.Subject, &tempResult.SubjectType, &tempResult.PersonInCharge, &tempResult.BenificiaryOwnership, &tempResult.Nation, &tempResult.Type, &tempResult.Year, &rank)
+		err = rows.Scan(&tempResult.ID, &tempResult.Subject, &tempResult.SubjectType, &tempResult.PersonInCharge, &tempResult.BenificiaryOwnership, &tempResult.Nation, &tempResult.Type, &tempResult.Year, &tempResult.EntityID, &tempResult.Score, &key)
 
 		if err != nil {
 			return emptyBaseModel, err
 		}
+
 		// map to search result
 		searchResult := SearchResultModel{
 			ID:                   tempResult.ID,
@@ -137,9 +159,16 @@ func SearchByRequest(ctx context.Context, tx pgx.Tx, searchRequest SearchRequest
 			Nation:               tempResult.Nation,
 			Type:                 tempResult.Type.String(),
 			Year:                 tempResult.Year,
+			EntityID:             tempResult.EntityID,
+			Score:                tempResult.Score,
 		}
 
 		searchResults = append(searchResults, searchResult)
+		nextCursor = SearchCursor{Sort: sort.String(), Key: key, ID: tempResult.ID}
+	}
+
+	if err = rows.Err(); err != nil {
+		return emptyBaseModel, err
 	}
 
 	if len(searchResults) == 0 {
@@ -147,10 +176,17 @@ func SearchByRequest(ctx context.Context, tx pgx.Tx, searchRequest SearchRequest
 	}
 
 	metaResponse := commonModels.MetaResponse{
-		CurrentPage: searchRequest.Page,
-		LastPage:    int64(math.Ceil(float64(itemCount) / float64(limit))),
-		PerPage:     int64(limit),
-		Total:       int64(itemCount),
+		PerPage: int64(limit),
+	}
+
+	if !useCursor {
+		metaResponse.CurrentPage = searchRequest.Page
+		metaResponse.LastPage = int64(math.Ceil(float64(itemCount) / float64(limit)))
+		metaResponse.Total = int64(itemCount)
+	}
+
+	if hasMore {
+		metaResponse.NextCursor = nextCursor.Encode()
 	}
 
 	baseResponse := commonModels.BasePaginationResponse{
@@ -161,6 +197,38 @@ func SearchByRequest(ctx context.Context, tx pgx.Tx, searchRequest SearchRequest
 	return baseResponse, nil
 }
 
+// searchWhereClause builds the filter shared by every query over the search
+// request. It expects the arguments returned by searchFilterArgs as $1 to $6.
+func searchWhereClause(searchRequest SearchRequest) string {
+	var clause string
+
+	if searchRequest.isFuzzy() {
+		clause = "WHERE " + fuzzyMatchClause()
+	} else if searchRequest.Query != "" {
+		clause = "WHERE fulltext_search_index @@ phraseto_tsquery('english', $1)"
+	} else {
+		clause = "WHERE $1 = $1"
+	}
+
+	clause += `
+	AND subject_type = ANY($2::int[])
+	AND year ~* $3
+	AND case_type = ANY($4::int[])
+	AND nation ~* $5
+	AND status = ANY($6::int[])
+	`
+	return clause
+}
+
+func searchFilterArgs(searchRequest SearchRequest) []interface{} {
+	query := searchRequest.Query
+	if searchRequest.isFuzzy() {
+		query = FoldName(query)
+	}
+
+	return []interface{}{query, normalizeSubjectTypes(searchRequest.SubjectTypes), normalizeYears(searchRequest.Years), normalizeCaseTypes(searchRequest.Types), normalizeNations(searchRequest.Nations), normalizeStatuses(searchRequest.Statuses)}
+}
+
 func normalizeYears(years []string) string {
 	return strings.Join(years, "|")
 }
@@ -183,6 +251,21 @@ func normalizeNations(nations []string) string {
 	return strings.Join(nations, "|")
 }
 
+// normalizeStatuses defaults to validated cases only.
+func normalizeStatuses(statuses []string) pgtype.FlatArray[CaseStatus] {
+	var tempStatuses pgtype.FlatArray[CaseStatus]
+
+	if len(statuses) == 0 {
+		return pgtype.FlatArray[CaseStatus]{validated}
+	}
+
+	for _, status := range statuses {
+		caseStatus, _ := newCaseStatus(status)
+		tempStatuses = append(tempStatuses, caseStatus)
+	}
+	return tempStatuses
+}
+
 func normalizeSubjectTypes(subjectTypes []string) pgtype.FlatArray[SubjectTypeInt] {
 	var tempSubjectTypes pgtype.FlatArray[SubjectTypeInt]
 
@@ -1,10 +1,115 @@
 package bo_v1_models
 
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	DefaultSearchPerPage = 20
+	MaxSearchPerPage     = 100
+)
+
 type SearchRequest struct {
-	Query        string   `json:"query"`
-	SubjectTypes []string `json:"subject_type"`
-	Years        []string `json:"years"`
-	Types        []string `json:"type"`
-	Nations      []string `json:"nation"`
-	Page         int64    `json:"page"`
+	Query        string        `json:"query"`
+	SubjectTypes []string      `json:"subject_type"`
+	Years        []string      `json:"years"`
+	Types        []string      `json:"type"`
+	Nations      []string      `json:"nation"`
+	Statuses     []string      `json:"status"`
+	Match        string        `json:"match"`
+	MinScore     float64       `json:"min_score"`
+	Page         int64         `json:"page"`
+	PerPage      int64         `json:"per_page"`
+	Sort         SearchSort    `json:"sort"`
+	Cursor       *SearchCursor `json:"cursor"`
+	Facets       []string      `json:"facets"`
+}
+
+// SearchSort is the ordering of search results. Ties are always broken by id
+// so the order is deterministic.
+type SearchSort struct {
+	Field string
+	Desc  bool
+}
+
+type searchSortField struct {
+	column      string
+	defaultDesc bool
+}
+
+// searchSortFields maps every sortable field to the expression used as sort
+// key and the direction used when none is given. Nullable columns are
+// coalesced so the key can be compared in a cursor. Relevance has no column,
+// its key is the rank of the query.
+var searchSortFields = map[string]searchSortField{
+	"relevance":  {column: "", defaultDesc: true},
+	"case_date":  {column: "COALESCE(case_date, '-infinity')", defaultDesc: true},
+	"year":       {column: "year", defaultDesc: true},
+	"subject":    {column: "subject", defaultDesc: false},
+	"updated_at": {column: "COALESCE(updated_at, '-infinity')", defaultDesc: true},
+}
+
+var DefaultSearchSort = SearchSort{Field: "relevance", Desc: true}
+
+var errInvalidSort = errors.New("sort must be one of relevance, case_date, year, subject, updated_at optionally followed by :asc or :desc")
+
+// ParseSearchSort parses a sort in the form of field[:asc|:desc].
+// An empty string is the default sort.
+func ParseSearchSort(s string) (SearchSort, error) {
+	if s == "" {
+		return DefaultSearchSort, nil
+	}
+
+	field, direction, hasDirection := strings.Cut(s, ":")
+
+	sortField, ok := searchSortFields[field]
+	if !ok {
+		return SearchSort{}, errInvalidSort
+	}
+	desc := sortField.defaultDesc
+
+	if hasDirection {
+		switch direction {
+		case "asc":
+			desc = false
+		case "desc":
+			desc = true
+		default:
+			return SearchSort{}, errInvalidSort
+		}
+	}
+
+	return SearchSort{Field: field, Desc: desc}, nil
+}
+
+func (s SearchSort) String() string {
+	if s.Desc {
+		return s.Field + ":desc"
+	}
+	return s.Field + ":asc"
+}
+
+// key returns the SQL expression the results are ordered by. Relevance ranks
+// against the query in $1, by similarity when the search is fuzzy.
+func (s SearchSort) key(searchRequest SearchRequest) string {
+	if s.Field != "relevance" {
+		return searchSortFields[s.Field].column
+	}
+
+	if searchRequest.Query == "" {
+		return "0::float8"
+	}
+
+	if searchRequest.isFuzzy() {
+		return fuzzyScoreColumn()
+	}
+	return "ts_rank_cd(fulltext_search_index, phraseto_tsquery('english', $1), 32 /* rank/(rank+1) */ )::float8"
+}
+
+func (s SearchSort) orDefault() SearchSort {
+	if s.Field == "" {
+		return DefaultSearchSort
+	}
+	return s
 }
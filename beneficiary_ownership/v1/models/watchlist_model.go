@@ -0,0 +1,278 @@
+package bo_v1_models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+type WatchlistItemKind int
+
+const (
+	watchSubject WatchlistItemKind = iota + 1
+	watchEntity
+)
+
+func (k WatchlistItemKind) String() string {
+	return [...]string{"subject", "entity"}[k-1]
+}
+
+func newWatchlistItemKind(s string) WatchlistItemKind {
+	switch s {
+	case "subject":
+		return watchSubject
+	case "entity":
+		return watchEntity
+	default:
+		return 0
+	}
+}
+
+type WatchlistItemModel struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type WatchlistModel struct {
+	ID         string               `json:"id"`
+	Owner      string               `json:"owner"`
+	Name       string               `json:"name"`
+	WebhookURL string               `json:"webhook_url"`
+	Items      []WatchlistItemModel `json:"items"`
+	CreatedAt  null.Time            `json:"created_at"`
+	UpdatedAt  null.Time            `json:"updated_at"`
+}
+
+// WebhookSecret is the key the webhooks of a watchlist are signed with, it
+// prints redacted so it stays out of the logs.
+type WebhookSecret string
+
+func (s WebhookSecret) String() string {
+	return "[redacted]"
+}
+
+// SecretWatchlistModel is a watchlist as its signing secret is set, the only
+// time the secret is shown.
+type SecretWatchlistModel struct {
+	WatchlistModel
+	SigningSecret WebhookSecret `json:"signing_secret"`
+}
+
+// NewWebhookSecret generates a random signing secret for a watchlist.
+func NewWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+type WatchlistRequest struct {
+	Name       string               `json:"name"`
+	WebhookURL string               `json:"webhook_url"`
+	Items      []WatchlistItemModel `json:"items"`
+}
+
+var errInvalidWatchlistItem = errors.New("items kind must be one of subject, entity and value is required")
+
+// Validate checks the request before it is stored.
+func (w WatchlistRequest) Validate() error {
+	if w.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if w.WebhookURL == "" {
+		return errors.New("webhook_url is required")
+	}
+
+	for _, item := range w.Items {
+		if newWatchlistItemKind(item.Kind) == 0 || item.Value == "" {
+			return errInvalidWatchlistItem
+		}
+	}
+
+	return nil
+}
+
+var emptyWatchlist WatchlistModel
+
+func CreateWatchlist(ctx context.Context, tx pgx.Tx, owner string, watchlistRequest WatchlistRequest, secret string) (WatchlistModel, error) {
+	id := ulid.Make().String()
+
+	query := `
+	INSERT INTO watchlists (id, owner, name, webhook_url, signing_secret, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, now(), now())
+	`
+
+	log.Info().Msg("Executing query: " + query)
+
+	_, err := tx.Exec(ctx, query, id, owner, watchlistRequest.Name, watchlistRequest.WebhookURL, secret)
+	if err != nil {
+		return emptyWatchlist, err
+	}
+
+	if err = replaceWatchlistItems(ctx, tx, id, watchlistRequest.Items); err != nil {
+		return emptyWatchlist, err
+	}
+
+	return GetWatchlistById(ctx, tx, owner, id)
+}
+
+func UpdateWatchlist(ctx context.Context, tx pgx.Tx, owner string, id string, watchlistRequest WatchlistRequest) (WatchlistModel, error) {
+	query := `
+	UPDATE watchlists
+	SET name = $3, webhook_url = $4, updated_at = now()
+	WHERE id = $1
+	AND owner = $2
+	`
+
+	log.Info().Msg("Executing query: " + query)
+
+	tag, err := tx.Exec(ctx, query, id, owner, watchlistRequest.Name, watchlistRequest.WebhookURL)
+	if err != nil {
+		return emptyWatchlist, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return emptyWatchlist, pgx.ErrNoRows
+	}
+
+	if err = replaceWatchlistItems(ctx, tx, id, watchlistRequest.Items); err != nil {
+		return emptyWatchlist, err
+	}
+
+	return GetWatchlistById(ctx, tx, owner, id)
+}
+
+// RotateWatchlistSecret replaces the signing secret of a watchlist of the
+// owner, the webhooks already queued are signed with the new one.
+func RotateWatchlistSecret(ctx context.Context, tx pgx.Tx, owner string, id string, secret string) (WatchlistModel, error) {
+	query := `
+	UPDATE watchlists
+	SET signing_secret = $3, updated_at = now()
+	WHERE id = $1
+	AND owner = $2
+	`
+
+	log.Info().Msg("Executing query: " + query)
+
+	tag, err := tx.Exec(ctx, query, id, owner, secret)
+	if err != nil {
+		return emptyWatchlist, err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return emptyWatchlist, pgx.ErrNoRows
+	}
+
+	return GetWatchlistById(ctx, tx, owner, id)
+}
+
+func replaceWatchlistItems(ctx context.Context, tx pgx.Tx, id string, items []WatchlistItemModel) error {
+	_, err := tx.Exec(ctx, `DELETE FROM watchlist_items WHERE watchlist_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		kind := newWatchlistItemKind(item.Kind)
+		value := item.Value
+
+		// subjects are matched on their normalized name
+		if kind == watchSubject {
+			value = normalizeEntityName(value)
+		}
+
+		_, err = tx.Exec(ctx, `INSERT INTO watchlist_items (watchlist_id, kind, value, label) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`, id, kind, value, item.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func DeleteWatchlist(ctx context.Context, tx pgx.Tx, owner string, id string) error {
+	tag, err := tx.Exec(ctx, `DELETE FROM watchlists WHERE id = $1 AND owner = $2`, id, owner)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+func GetWatchlistById(ctx context.Context, tx pgx.Tx, owner string, id string) (WatchlistModel, error) {
+	watchlists, err := getWatchlists(ctx, tx, owner, id)
+	if err != nil {
+		return emptyWatchlist, err
+	}
+
+	if len(watchlists) == 0 {
+		return emptyWatchlist, pgx.ErrNoRows
+	}
+
+	return watchlists[0], nil
+}
+
+func GetWatchlists(ctx context.Context, tx pgx.Tx, owner string) ([]WatchlistModel, error) {
+	return getWatchlists(ctx, tx, owner, "")
+}
+
+// getWatchlists returns the watchlists of an owner with their items, only the
+// one with the given id when it is not empty.
+func getWatchlists(ctx context.Context, tx pgx.Tx, owner string, id string) ([]WatchlistModel, error) {
+	query := `
+	SELECT w.id, w.owner, w.name, w.webhook_url, w.created_at, w.updated_at, i.kind, i.label
+	FROM watchlists w
+	LEFT JOIN watchlist_items i ON i.watchlist_id = w.id
+	WHERE w.owner = $1
+	AND ($2 = '' OR w.id = $2)
+	ORDER BY w.created_at DESC, w.id ASC, i.label ASC
+	`
+
+	log.Info().Msg("Executing query: " + query)
+
+	rows, err := tx.Query(ctx, query, owner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	watchlists := []WatchlistModel{}
+
+	for rows.Next() {
+		var watchlist WatchlistModel
+		var kind null.Int
+		var label null.String
+
+		err = rows.Scan(&watchlist.ID, &watchlist.Owner, &watchlist.Name, &watchlist.WebhookURL, &watchlist.CreatedAt, &watchlist.UpdatedAt, &kind, &label)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(watchlists) == 0 || watchlists[len(watchlists)-1].ID != watchlist.ID {
+			watchlist.Items = []WatchlistItemModel{}
+			watchlists = append(watchlists, watchlist)
+		}
+
+		if kind.Valid {
+			last := &watchlists[len(watchlists)-1]
+			last.Items = append(last.Items, WatchlistItemModel{Kind: WatchlistItemKind(kind.Int64).String(), Value: label.String})
+		}
+	}
+
+	return watchlists, rows.Err()
+}
@@ -0,0 +1,472 @@
+package bo_v1_models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+type DeliveryStatus int
+
+const (
+	deliveryPending DeliveryStatus = iota + 1
+	deliveryDelivered
+	deliveryFailed
+)
+
+func (d DeliveryStatus) String() string {
+	return [...]string{"pending", "delivered", "failed"}[d-1]
+}
+
+const (
+	// MaxDeliveryAttempts is the number of tries before a delivery is failed.
+	MaxDeliveryAttempts = 6
+	eventCaseAdded      = "case.added"
+	eventCaseChanged    = "case.changed"
+	watchlistBatchSize  = 500
+	// watchlistScanLag is how far behind its watermark the worker scans
+	// again. updated_at is the start of the transaction writing a case, a
+	// write taking up to this long to commit is still seen.
+	watchlistScanLag = 10 * time.Minute
+)
+
+type WebhookChange struct {
+	Before null.String `json:"before"`
+	After  null.String `json:"after"`
+}
+
+type WebhookCaseModel struct {
+	SearchResultModel
+	Status          string      `json:"status"`
+	PunishmentStart null.String `json:"punishment_start"`
+	PunishmentEnd   null.String `json:"punishment_end"`
+}
+
+type WebhookEventModel struct {
+	ID          string                   `json:"id"`
+	Event       string                   `json:"event"`
+	WatchlistID string                   `json:"watchlist_id"`
+	OccurredAt  time.Time                `json:"occurred_at"`
+	Case        WebhookCaseModel         `json:"case"`
+	Changes     map[string]WebhookChange `json:"changes,omitempty"`
+	Matched     []WatchlistItemModel     `json:"matched"`
+}
+
+type WebhookDeliveryModel struct {
+	ID             string      `json:"id"`
+	WatchlistID    string      `json:"watchlist_id"`
+	Event          string      `json:"event"`
+	CaseID         string      `json:"case_id"`
+	Status         string      `json:"status"`
+	Attempts       int         `json:"attempts"`
+	LastStatusCode null.Int    `json:"last_status_code"`
+	LastError      null.String `json:"last_error"`
+	NextAttemptAt  null.Time   `json:"next_attempt_at"`
+	DeliveredAt    null.Time   `json:"delivered_at"`
+	CreatedAt      time.Time   `json:"created_at"`
+}
+
+// DueDelivery is a pending delivery ready to be sent.
+type DueDelivery struct {
+	ID            string
+	WebhookURL    string
+	SigningSecret string
+	Payload       []byte
+	Attempts      int
+}
+
+type watchedCase struct {
+	Case        WebhookCaseModel
+	hasSnapshot bool
+	before      caseSnapshot
+	after       caseSnapshot
+	updatedAt   time.Time
+}
+
+type caseSnapshot struct {
+	Status          CaseStatus
+	PunishmentStart null.Time
+	PunishmentEnd   null.Time
+}
+
+type watchTarget struct {
+	watchlistID string
+	item        WatchlistItemModel
+}
+
+func formatSnapshotDate(t null.Time) null.String {
+	return null.NewString(t.Time.Format("2006-01-02"), t.Valid)
+}
+
+// changes lists the watched fields that differ between two snapshots.
+func (s caseSnapshot) changes(after caseSnapshot) map[string]WebhookChange {
+	changes := map[string]WebhookChange{}
+
+	if s.Status != after.Status {
+		changes["status"] = WebhookChange{Before: null.StringFrom(s.Status.String()), After: null.StringFrom(after.Status.String())}
+	}
+
+	if before, now := formatSnapshotDate(s.PunishmentStart), formatSnapshotDate(after.PunishmentStart); before != now {
+		changes["punishment_start"] = WebhookChange{Before: before, After: now}
+	}
+
+	if before, now := formatSnapshotDate(s.PunishmentEnd), formatSnapshotDate(after.PunishmentEnd); before != now {
+		changes["punishment_end"] = WebhookChange{Before: before, After: now}
+	}
+
+	return changes
+}
+
+// CollectWatchlistEvents diffs the cases updated since the last run against
+// their snapshots and queues a delivery for every watchlist a changed case
+// mentions. A case is added when it becomes validated and changed when a
+// validated case changes status or punishment. The first run only takes the
+// snapshots.
+//
+// Each run scans from watchlistScanLag behind the watermark, so a write that
+// committed after a run that passed its updated_at is still seen. A version
+// of a case is only diffed once, its snapshot keeps the updated_at it was
+// taken at.
+func CollectWatchlistEvents(ctx context.Context, tx pgx.Tx) (int, error) {
+	var lastUpdatedAt time.Time
+	var lastCaseID string
+
+	err := tx.QueryRow(ctx, `SELECT last_updated_at, last_case_id FROM watchlist_worker_state WHERE id = 1 FOR UPDATE`).Scan(&lastUpdatedAt, &lastCaseID)
+
+	if err == pgx.ErrNoRows {
+		log.Info().Msg("Initializing watchlist snapshots")
+
+		_, err = tx.Exec(ctx, `
+		INSERT INTO watchlist_case_snapshots (case_id, status, punishment_start, punishment_end, updated_at)
+		SELECT id, status, punishment_start, punishment_end, updated_at FROM cases
+		ON CONFLICT (case_id) DO NOTHING
+		`)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(ctx, `INSERT INTO watchlist_worker_state (id, last_updated_at, last_case_id) SELECT 1, COALESCE(max(updated_at), now()), '' FROM cases`)
+		return 0, err
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	targets, err := getWatchTargets(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	scannedAt, scannedID := lastUpdatedAt.Add(-watchlistScanLag), ""
+
+	for {
+		batch, err := getChangedCases(ctx, tx, scannedAt, scannedID)
+		if err != nil {
+			return queued, err
+		}
+
+		for _, changed := range batch {
+			count, err := queueCaseEvents(ctx, tx, changed, targets)
+			if err != nil {
+				return queued, err
+			}
+			queued += count
+
+			_, err = tx.Exec(ctx, `
+			INSERT INTO watchlist_case_snapshots (case_id, status, punishment_start, punishment_end, updated_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (case_id) DO UPDATE SET status = EXCLUDED.status, punishment_start = EXCLUDED.punishment_start, punishment_end = EXCLUDED.punishment_end, updated_at = EXCLUDED.updated_at
+			`, changed.Case.ID.String(), changed.after.Status, changed.after.PunishmentStart, changed.after.PunishmentEnd, changed.updatedAt)
+			if err != nil {
+				return queued, err
+			}
+
+			scannedAt, scannedID = changed.updatedAt, changed.Case.ID.String()
+
+			if changed.updatedAt.After(lastUpdatedAt) || changed.updatedAt.Equal(lastUpdatedAt) && scannedID > lastCaseID {
+				lastUpdatedAt, lastCaseID = scannedAt, scannedID
+			}
+		}
+
+		if len(batch) < watchlistBatchSize {
+			break
+		}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE watchlist_worker_state SET last_updated_at = $1, last_case_id = $2 WHERE id = 1`, lastUpdatedAt, lastCaseID)
+
+	return queued, err
+}
+
+// getWatchTargets indexes every watchlist item by the value it matches on.
+func getWatchTargets(ctx context.Context, tx pgx.Tx) (map[string][]watchTarget, error) {
+	rows, err := tx.Query(ctx, `SELECT watchlist_id, kind, value, label FROM watchlist_items`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	targets := map[string][]watchTarget{}
+
+	for rows.Next() {
+		var watchlistID, value, label string
+		var kind WatchlistItemKind
+
+		if err = rows.Scan(&watchlistID, &kind, &value, &label); err != nil {
+			return nil, err
+		}
+
+		key := kind.String() + ":" + value
+		targets[key] = append(targets[key], watchTarget{watchlistID: watchlistID, item: WatchlistItemModel{Kind: kind.String(), Value: label}})
+	}
+
+	return targets, rows.Err()
+}
+
+// getChangedCases returns the next batch of cases after (updatedAt, caseID)
+// whose version is not the one of their snapshot.
+func getChangedCases(ctx context.Context, tx pgx.Tx, updatedAt time.Time, caseID string) ([]watchedCase, error) {
+	query := `
+	SELECT c.id, c.subject, c.subject_type, c.person_in_charge, c.benificiary_ownership, c.nation, c.case_type, c.year,
+		c.status, c.punishment_start, c.punishment_end, c.updated_at,
+		s.case_id IS NOT NULL, COALESCE(s.status, 0), s.punishment_start, s.punishment_end
+	FROM cases c
+	LEFT JOIN watchlist_case_snapshots s ON s.case_id = c.id
+	WHERE (c.updated_at, c.id) > ($1, $2)
+	AND (s.updated_at IS NULL OR s.updated_at <> c.updated_at)
+	ORDER BY c.updated_at ASC, c.id ASC
+	LIMIT $3
+	`
+
+	rows, err := tx.Query(ctx, query, updatedAt, caseID, watchlistBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (watchedCase, error) {
+		var changed watchedCase
+		var temp tempSearchResult
+
+		err := row.Scan(&temp.ID, &temp.Subject, &temp.SubjectType, &temp.PersonInCharge, &temp.BenificiaryOwnership, &temp.Nation, &temp.Type, &temp.Year,
+			&changed.after.Status, &changed.after.PunishmentStart, &changed.after.PunishmentEnd, &changed.updatedAt,
+			&changed.hasSnapshot, &changed.before.Status, &changed.before.PunishmentStart, &changed.before.PunishmentEnd)
+		if err != nil {
+			return changed, err
+		}
+
+		changed.Case = WebhookCaseModel{
+			SearchResultModel: SearchResultModel{
+				ID:                   temp.ID,
+				Subject:              temp.Subject,
+				SubjectType:          temp.SubjectType.String(),
+				PersonInCharge:       temp.PersonInCharge,
+				BenificiaryOwnership: temp.BenificiaryOwnership,
+				Nation:               temp.Nation,
+				Type:                 temp.Type.String(),
+				Year:                 temp.Year,
+			},
+			Status:          changed.after.Status.String(),
+			PunishmentStart: formatSnapshotDate(changed.after.PunishmentStart),
+			PunishmentEnd:   formatSnapshotDate(changed.after.PunishmentEnd),
+		}
+
+		return changed, nil
+	})
+}
+
+// queueCaseEvents queues one delivery per watchlist matching a changed case.
+func queueCaseEvents(ctx context.Context, tx pgx.Tx, changed watchedCase, targets map[string][]watchTarget) (int, error) {
+	var event string
+	var changes map[string]WebhookChange
+
+	wasValidated := changed.hasSnapshot && changed.before.Status == validated
+
+	switch {
+	case changed.after.Status == validated && !wasValidated:
+		event = eventCaseAdded
+	case wasValidated:
+		changes = changed.before.changes(changed.after)
+		if len(changes) == 0 {
+			return 0, nil
+		}
+		event = eventCaseChanged
+	default:
+		return 0, nil
+	}
+
+	keys := map[string]bool{"subject:" + normalizeEntityName(changed.Case.Subject): true}
+
+	for _, party := range ParseParties(changed.Case.BenificiaryOwnership.String + ";" + changed.Case.PersonInCharge.String) {
+		keys["subject:"+normalizeEntityName(party.Name)] = true
+	}
+
+	rows, err := tx.Query(ctx, `SELECT DISTINCT source_entity_id FROM entity_relations WHERE case_id = $1`, changed.Case.ID.String())
+	if err != nil {
+		return 0, err
+	}
+
+	entityIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range entityIDs {
+		keys["entity:"+id] = true
+	}
+
+	matched := map[string][]WatchlistItemModel{}
+
+	for key := range keys {
+		for _, target := range targets[key] {
+			matched[target.watchlistID] = append(matched[target.watchlistID], target.item)
+		}
+	}
+
+	for watchlistID, items := range matched {
+		payload := WebhookEventModel{
+			ID:          ulid.Make().String(),
+			Event:       event,
+			WatchlistID: watchlistID,
+			OccurredAt:  changed.updatedAt,
+			Case:        changed.Case,
+			Changes:     changes,
+			Matched:     items,
+		}
+
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(ctx, `
+		INSERT INTO webhook_deliveries (id, watchlist_id, event, case_id, payload, status, attempts, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, 0, now(), now())
+		`, payload.ID, watchlistID, event, changed.Case.ID.String(), raw, deliveryPending)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(matched), nil
+}
+
+// ClaimDueDeliveries leases up to limit pending deliveries whose next attempt
+// is due, skipping the ones another worker is claiming. A claimed delivery is
+// not due again until the lease ends, so it is retried if the worker stops
+// before recording the attempt.
+func ClaimDueDeliveries(ctx context.Context, tx pgx.Tx, limit int, lease time.Duration) ([]DueDelivery, error) {
+	query := `
+	WITH due AS (
+		SELECT id
+		FROM webhook_deliveries
+		WHERE status = $1
+		AND next_attempt_at <= now()
+		ORDER BY next_attempt_at ASC
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	)
+	UPDATE webhook_deliveries d
+	SET next_attempt_at = now() + make_interval(secs => $3)
+	FROM due, watchlists w
+	WHERE d.id = due.id
+	AND w.id = d.watchlist_id
+	RETURNING d.id, w.webhook_url, w.signing_secret, d.payload, d.attempts
+	`
+
+	rows, err := tx.Query(ctx, query, deliveryPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (DueDelivery, error) {
+		var delivery DueDelivery
+		err := row.Scan(&delivery.ID, &delivery.WebhookURL, &delivery.SigningSecret, &delivery.Payload, &delivery.Attempts)
+		return delivery, err
+	})
+}
+
+// RecordDeliveryAttempt stores the outcome of an attempt. A failed attempt is
+// retried with an exponential backoff until MaxDeliveryAttempts is reached.
+func RecordDeliveryAttempt(ctx context.Context, tx pgx.Tx, delivery DueDelivery, statusCode int, attemptErr error) error {
+	attempts := delivery.Attempts + 1
+	code := null.NewInt(int64(statusCode), statusCode != 0)
+
+	if attemptErr == nil {
+		_, err := tx.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, last_status_code = $4, last_error = NULL, next_attempt_at = NULL, delivered_at = now()
+		WHERE id = $1
+		`, delivery.ID, deliveryDelivered, attempts, code)
+		return err
+	}
+
+	status := deliveryPending
+	nextAttempt := null.TimeFrom(time.Now().Add(time.Duration(1<<attempts) * time.Minute))
+
+	if attempts >= MaxDeliveryAttempts {
+		status = deliveryFailed
+		nextAttempt = null.Time{}
+	}
+
+	_, err := tx.Exec(ctx, `
+	UPDATE webhook_deliveries
+	SET status = $2, attempts = $3, last_status_code = $4, last_error = $5, next_attempt_at = $6
+	WHERE id = $1
+	`, delivery.ID, status, attempts, code, attemptErr.Error(), nextAttempt)
+
+	return err
+}
+
+// GetDeliveries returns the latest deliveries of a watchlist of the owner,
+// pgx.ErrNoRows when the owner has no such watchlist.
+func GetDeliveries(ctx context.Context, tx pgx.Tx, owner string, watchlistID string, limit int) ([]WebhookDeliveryModel, error) {
+	var exists bool
+
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM watchlists WHERE id = $1 AND owner = $2)`, watchlistID, owner).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, pgx.ErrNoRows
+	}
+
+	query := `
+	SELECT d.id, d.watchlist_id, d.event, d.case_id, d.status, d.attempts, d.last_status_code, d.last_error, d.next_attempt_at, d.delivered_at, d.created_at
+	FROM webhook_deliveries d
+	JOIN watchlists w ON w.id = d.watchlist_id
+	WHERE d.watchlist_id = $1
+	AND w.owner = $2
+	ORDER BY d.created_at DESC, d.id DESC
+	LIMIT $3
+	`
+
+	log.Info().Msg("Executing query: " + query)
+
+	rows, err := tx.Query(ctx, query, watchlistID, owner, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (WebhookDeliveryModel, error) {
+		var delivery WebhookDeliveryModel
+		var status DeliveryStatus
+
+		err := row.Scan(&delivery.ID, &delivery.WatchlistID, &delivery.Event, &delivery.CaseID, &status, &delivery.Attempts, &delivery.LastStatusCode, &delivery.LastError, &delivery.NextAttemptAt, &delivery.DeliveredAt, &delivery.CreatedAt)
+		if err != nil {
+			return delivery, err
+		}
+
+		delivery.Status = status.String()
+
+		return delivery, nil
+	})
+}
@@ -0,0 +1,335 @@
+package bo_v1_repositories
+
+import (
+	"context"
+	"encoding/json"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+	commonModels "lexicon/bo-api/common/models"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/oklog/ulid/v2"
+	"gopkg.in/guregu/null.v4"
+)
+
+// statuses of a case as they are served
+const (
+	statusDeleted   = "deleted"
+	statusValidated = "validated"
+	statusDraft     = "draft"
+)
+
+// MemoryCaseRepository keeps cases and their revisions in memory, so the
+// routes of the case service can be exercised without a database. It follows the rules of the
+// Postgres repository, except that the graph of a case is not extracted.
+type MemoryCaseRepository struct {
+	mu        sync.Mutex
+	cases     map[string]models.CaseModel
+	revisions []models.CaseRevisionModel
+	lastWrite time.Time
+}
+
+var _ CaseRepository = (*MemoryCaseRepository)(nil)
+
+// NewMemoryCaseRepository starts from the given cases, a case without an id
+// or timestamps gets them as if it was just written.
+func NewMemoryCaseRepository(cases ...models.CaseModel) *MemoryCaseRepository {
+	r := &MemoryCaseRepository{cases: map[string]models.CaseModel{}}
+
+	for _, c := range cases {
+		if c.ID == (ulid.ULID{}) {
+			c.ID = ulid.Make()
+		}
+
+		if c.Status == "" {
+			c.Status = statusDraft
+		}
+
+		if !c.CreatedAt.Valid {
+			c.CreatedAt = null.TimeFrom(r.now())
+		}
+
+		if !c.UpdatedAt.Valid {
+			c.UpdatedAt = c.CreatedAt
+		}
+
+		r.cases[c.ID.String()] = c
+	}
+
+	return r
+}
+
+// now keeps the precision of a Postgres timestamp and never repeats, so a
+// stale updated_at is always told apart from the current one.
+func (r *MemoryCaseRepository) now() time.Time {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	if !now.After(r.lastWrite) {
+		now = r.lastWrite.Add(time.Microsecond)
+	}
+
+	r.lastWrite = now
+
+	return now
+}
+
+// record appends a revision for a write made at the time of after.UpdatedAt.
+func (r *MemoryCaseRepository) record(actor string, action string, before models.CaseModel, after models.CaseModel) error {
+	changes, err := models.DiffCases(before, after)
+	if err != nil {
+		return err
+	}
+
+	r.revisions = append(r.revisions, models.CaseRevisionModel{
+		ID:        ulid.Make(),
+		CaseID:    after.ID.String(),
+		Actor:     actor,
+		Action:    action,
+		Changes:   changes,
+		CreatedAt: after.UpdatedAt,
+	})
+
+	return nil
+}
+
+func (r *MemoryCaseRepository) GetDetail(ctx context.Context, id string) (models.DetailResultModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.cases[id]
+	if !ok || c.Status != statusValidated {
+		return models.DetailResultModel{}, pgx.ErrNoRows
+	}
+
+	return c.Detail(), nil
+}
+
+func (r *MemoryCaseRepository) GetIdsByCaseNumbers(ctx context.Context, caseNumbers []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []string
+
+	for id, c := range r.cases {
+		if c.DecisionNumber.Valid && slices.Contains(caseNumbers, c.DecisionNumber.String) {
+			ids = append(ids, id)
+		}
+	}
+
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+func (r *MemoryCaseRepository) GetCaseHistory(ctx context.Context, id string) ([]models.CaseRevisionModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.cases[id]; !ok || c.Status != statusValidated {
+		return nil, pgx.ErrNoRows
+	}
+
+	revisions := []models.CaseRevisionModel{}
+
+	for _, revision := range r.revisions {
+		if revision.CaseID == id {
+			revisions = append(revisions, revision)
+		}
+	}
+
+	return revisions, nil
+}
+
+func (r *MemoryCaseRepository) GetCase(ctx context.Context, id string) (models.CaseModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.cases[id]
+	if !ok {
+		return models.CaseModel{}, pgx.ErrNoRows
+	}
+
+	return c, nil
+}
+
+func (r *MemoryCaseRepository) GetCases(ctx context.Context, status string, page int64, perPage int64) (commonModels.BasePaginationResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !models.IsCaseStatus(status) {
+		status = statusDraft
+	}
+
+	cases := []models.CaseModel{}
+
+	for _, c := range r.cases {
+		if c.Status == status {
+			cases = append(cases, c)
+		}
+	}
+
+	sort.Slice(cases, func(i, j int) bool {
+		if !cases[i].UpdatedAt.Time.Equal(cases[j].UpdatedAt.Time) {
+			return cases[i].UpdatedAt.Time.After(cases[j].UpdatedAt.Time)
+		}
+		return cases[i].ID.Compare(cases[j].ID) < 0
+	})
+
+	total := int64(len(cases))
+	start := min((page-1)*perPage, total)
+	end := min(start+perPage, total)
+
+	return commonModels.BasePaginationResponse{
+		Data: cases[start:end],
+		Meta: commonModels.MetaResponse{
+			CurrentPage: page,
+			LastPage:    int64(math.Ceil(float64(total) / float64(perPage))),
+			PerPage:     perPage,
+			Total:       total,
+		},
+	}, nil
+}
+
+func (r *MemoryCaseRepository) CreateCase(ctx context.Context, actor string, fields models.CaseFields) (models.CaseModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.create(actor, fields)
+}
+
+func (r *MemoryCaseRepository) create(actor string, fields models.CaseFields) (models.CaseModel, error) {
+	now := null.TimeFrom(r.now())
+	created := models.CaseModel{ID: ulid.Make(), CaseFields: fields, Status: statusDraft, CreatedAt: now, UpdatedAt: now}
+
+	if err := r.record(actor, models.CaseCreated, models.CaseModel{}, created); err != nil {
+		return models.CaseModel{}, err
+	}
+
+	r.cases[created.ID.String()] = created
+
+	return created, nil
+}
+
+// write changes a case of one of the allowed statuses, as long as updatedAt
+// is the one the case still has.
+func (r *MemoryCaseRepository) write(actor string, action string, id string, updatedAt null.Time, allowed []string, change func(c *models.CaseModel)) (models.CaseModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, ok := r.cases[id]
+	if !ok {
+		return models.CaseModel{}, pgx.ErrNoRows
+	}
+
+	if !slices.Contains(allowed, before.Status) {
+		return models.CaseModel{}, models.ErrCaseTransition
+	}
+
+	if !updatedAt.Valid || !updatedAt.Time.Equal(before.UpdatedAt.Time) {
+		return models.CaseModel{}, models.ErrCaseConflict
+	}
+
+	written := before
+	change(&written)
+	written.UpdatedAt = null.TimeFrom(r.now())
+
+	if err := r.record(actor, action, before, written); err != nil {
+		return models.CaseModel{}, err
+	}
+
+	r.cases[id] = written
+
+	return written, nil
+}
+
+func (r *MemoryCaseRepository) UpdateCase(ctx context.Context, actor string, id string, caseRequest models.CaseRequest) (models.CaseModel, error) {
+	return r.write(actor, models.CaseUpdated, id, caseRequest.UpdatedAt, []string{statusDraft, statusValidated}, func(c *models.CaseModel) {
+		c.CaseFields = caseRequest.CaseFields
+	})
+}
+
+func (r *MemoryCaseRepository) ValidateCase(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error) {
+	return r.write(actor, models.CaseValidated, id, updatedAt, []string{statusDraft}, func(c *models.CaseModel) {
+		c.Status = statusValidated
+	})
+}
+
+func (r *MemoryCaseRepository) DeleteCase(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error) {
+	return r.write(actor, models.CaseDeleted, id, updatedAt, []string{statusDraft, statusValidated}, func(c *models.CaseModel) {
+		c.Status = statusDeleted
+	})
+}
+
+func (r *MemoryCaseRepository) RestoreCase(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error) {
+	return r.write(actor, models.CaseRestored, id, updatedAt, []string{statusDeleted}, func(c *models.CaseModel) {
+		c.Status = statusDraft
+	})
+}
+
+func (r *MemoryCaseRepository) ImportCases(ctx context.Context, actor string, records []json.RawMessage) (models.CaseImportReport, error) {
+	results, imported := models.ParseCaseImport(records)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	type key struct{ decisionNumber, source string }
+
+	existing := map[key]string{}
+	for id, c := range r.cases {
+		existing[key{c.DecisionNumber.String, c.Source}] = id
+	}
+
+	for _, row := range imported {
+		result := &results[row.Row]
+
+		id, ok := existing[key{row.Fields.DecisionNumber.String, row.Fields.Source}]
+		if !ok {
+			created, err := r.create(actor, row.Fields)
+			if err != nil {
+				return models.CaseImportReport{}, err
+			}
+
+			result.Status = models.CaseImportCreated
+			result.ID = created.ID.String()
+			continue
+		}
+
+		before := r.cases[id]
+		result.ID = id
+
+		if before.Status == statusDeleted {
+			result.Status = models.CaseImportSkipped
+			result.Error = models.ErrCaseImportDeleted.Error()
+			continue
+		}
+
+		written := before
+		written.CaseFields = row.Fields
+
+		changes, err := models.DiffCases(before, written)
+		if err != nil {
+			return models.CaseImportReport{}, err
+		}
+
+		if len(changes) == 0 {
+			result.Status = models.CaseImportUnchanged
+			continue
+		}
+
+		written.Status = statusDraft
+		written.UpdatedAt = null.TimeFrom(r.now())
+
+		if err = r.record(actor, models.CaseUpdated, before, written); err != nil {
+			return models.CaseImportReport{}, err
+		}
+
+		r.cases[id] = written
+		result.Status = models.CaseImportUpdated
+	}
+
+	return models.NewCaseImportReport(results), nil
+}
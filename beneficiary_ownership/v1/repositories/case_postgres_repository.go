@@ -0,0 +1,109 @@
+package bo_v1_repositories
+
+import (
+	"context"
+	"encoding/json"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+	commonModels "lexicon/bo-api/common/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gopkg.in/guregu/null.v4"
+)
+
+// PostgresCaseRepository runs every call in its own transaction on the pool.
+type PostgresCaseRepository struct {
+	pool *pgxpool.Pool
+}
+
+var _ CaseRepository = (*PostgresCaseRepository)(nil)
+
+func NewPostgresCaseRepository(pool *pgxpool.Pool) *PostgresCaseRepository {
+	return &PostgresCaseRepository{pool: pool}
+}
+
+// inTx runs fn in a transaction, it is rolled back when fn fails.
+func inTx[T any](ctx context.Context, pool *pgxpool.Pool, fn func(tx pgx.Tx) (T, error)) (T, error) {
+	var empty T
+
+	tx, err := pool.Begin(ctx)
+
+	if err != nil {
+		return empty, err
+	}
+
+	result, err := fn(tx)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return empty, err
+	}
+
+	return result, tx.Commit(ctx)
+}
+
+func (r *PostgresCaseRepository) GetDetail(ctx context.Context, id string) (models.DetailResultModel, error) {
+	return inTx(ctx, r.pool, func(tx pgx.Tx) (models.DetailResultModel, error) {
+		return models.GetDetailById(ctx, tx, id)
+	})
+}
+
+func (r *PostgresCaseRepository) GetIdsByCaseNumbers(ctx context.Context, caseNumbers []string) ([]string, error) {
+	return inTx(ctx, r.pool, func(tx pgx.Tx) ([]string, error) {
+		return models.GetIdsByCaseNumbers(ctx, tx, caseNumbers)
+	})
+}
+
+func (r *PostgresCaseRepository) GetCaseHistory(ctx context.Context, id string) ([]models.CaseRevisionModel, error) {
+	return inTx(ctx, r.pool, func(tx pgx.Tx) ([]models.CaseRevisionModel, error) {
+		return models.GetCaseRevisions(ctx, tx, id)
+	})
+}
+
+func (r *PostgresCaseRepository) GetCase(ctx context.Context, id string) (models.CaseModel, error) {
+	return inTx(ctx, r.pool, func(tx pgx.Tx) (models.CaseModel, error) {
+		return models.GetCaseById(ctx, tx, id)
+	})
+}
+
+func (r *PostgresCaseRepository) GetCases(ctx context.Context, status string, page int64, perPage int64) (commonModels.BasePaginationResponse, error) {
+	return inTx(ctx, r.pool, func(tx pgx.Tx) (commonModels.BasePaginationResponse, error) {
+		return models.GetCases(ctx, tx, status, page, perPage)
+	})
+}
+
+func (r *PostgresCaseRepository) CreateCase(ctx context.Context, actor string, fields models.CaseFields) (models.CaseModel, error) {
+	return inTx(ctx, r.pool, func(tx pgx.Tx) (models.CaseModel, error) {
+		return models.CreateCase(ctx, tx, actor, fields)
+	})
+}
+
+func (r *PostgresCaseRepository) UpdateCase(ctx context.Context, actor string, id string, caseRequest models.CaseRequest) (models.CaseModel, error) {
+	return inTx(ctx, r.pool, func(tx pgx.Tx) (models.CaseModel, error) {
+		return models.UpdateCase(ctx, tx, actor, id, caseRequest)
+	})
+}
+
+func (r *PostgresCaseRepository) ValidateCase(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error) {
+	return inTx(ctx, r.pool, func(tx pgx.Tx) (models.CaseModel, error) {
+		return models.ValidateCase(ctx, tx, actor, id, updatedAt)
+	})
+}
+
+func (r *PostgresCaseRepository) DeleteCase(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error) {
+	return inTx(ctx, r.pool, func(tx pgx.Tx) (models.CaseModel, error) {
+		return models.DeleteCase(ctx, tx, actor, id, updatedAt)
+	})
+}
+
+func (r *PostgresCaseRepository) RestoreCase(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error) {
+	return inTx(ctx, r.pool, func(tx pgx.Tx) (models.CaseModel, error) {
+		return models.RestoreCase(ctx, tx, actor, id, updatedAt)
+	})
+}
+
+func (r *PostgresCaseRepository) ImportCases(ctx context.Context, actor string, records []json.RawMessage) (models.CaseImportReport, error) {
+	return inTx(ctx, r.pool, func(tx pgx.Tx) (models.CaseImportReport, error) {
+		return models.ImportCases(ctx, tx, actor, records)
+	})
+}
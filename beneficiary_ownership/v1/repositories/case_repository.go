@@ -2,82 +2,41 @@ package bo_v1_repositories
 
 import (
 	"context"
+	"encoding/json"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+	commonModels "lexicon/bo-api/common/models"
 
-	"github.com/jackc/pgx/v5"
-	"github.com/oklog/ulid/v2"
-	"github.com/rs/zerolog/log"
 	"gopkg.in/guregu/null.v4"
 )
 
-type DetailResultModel struct {
-	ID                   ulid.ULID   `json:"id"`
-	Subject              string      `json:"subject"`
-	SubjectType          string      `json:"subject_type"`
-	PersonInCharge       null.String `json:"person_in_charge"`
-	BenificiaryOwnership null.String `json:"benificiary_ownership"`
-	Date                 null.Time   `json:"date"`
-	DecisionNumber       null.String `json:"decision_number"`
-	Source               string      `json:"source"`
-	Link                 string      `json:"link"`
-	Nation               string      `json:"nation"`
-	PunishmentDuration   null.String `json:"punishment_duration"`
-	Type                 string      `json:"type"`
-	Year                 string      `json:"year"`
-	Summary              string      `json:"summary"`
-}
-
-var emptyDetail DetailResultModel
-
-func GetDetailById(ctx context.Context, tx pgx.Tx, id string) (DetailResultModel, error) {
-	var result DetailResultModel
-
-	log.Info().Msg("Start getting detail by id: " + id)
-	query := `
-	SELECT id, subject, subject_type, person_in_charge, benificiary_ownership, date, decision_number, source, link, nation, punishment_duration, type, year, summary
-	FROM cases
-	WHERE id = $1
-	LIMIT 1
-	`
-
-	log.Info().Msg("Executing query: " + query)
-	row := tx.QueryRow(ctx, query, id)
-	err := row.Scan(&result.ID, &result.Subject, &result.SubjectType, &result.PersonInCharge, &result.BenificiaryOwnership, &result.Date, &result.DecisionNumber, &result.Source, &result.Link, &result.Nation, &result.PunishmentDuration, &result.Type, &result.Year, &result.Summary)
-
-	if err != nil {
-		log.Info().Msg("Data Not Found")
-
-		return emptyDetail, err
-	}
-
-	log.Info().Msg("Finish getting detail by id: " + id)
-	log.Info().Msg("Data Found")
-	return result, nil
-}
-
-func GetIdsByCaseNumbers(ctx context.Context, tx pgx.Tx, caseNumbers []string) ([]string, error) {
-	var ids []string
-
-	query := `
-	SELECT id
-	FROM cases
-	WHERE decision_number = ANY($1)
-	`
-
-	row, err := tx.Query(ctx, query, caseNumbers)
-	if err != nil {
-		log.Err(err).Msg("Error executing query")
-		return nil, err
-	}
-	defer row.Close()
-	for row.Next() {
-		var id string
-		err := row.Scan(&id)
-		if err != nil {
-			log.Err(err).Msg("Error scanning row")
-			return nil, err
-		}
-		ids = append(ids, id)
-	}
-
-	return ids, nil
+// CaseRepository reads and writes cases. A case that does not exist, or is
+// not published where only published cases are served, is reported as
+// pgx.ErrNoRows. Writes return models.ErrCaseConflict for a stale updated_at
+// and models.ErrCaseTransition for a case in the wrong status.
+type CaseRepository interface {
+	// GetDetail returns a published case.
+	GetDetail(ctx context.Context, id string) (models.DetailResultModel, error)
+	// GetIdsByCaseNumbers returns the ids of the cases with one of the
+	// decision numbers.
+	GetIdsByCaseNumbers(ctx context.Context, caseNumbers []string) ([]string, error)
+	// GetCaseHistory returns the revisions of a published case, the oldest
+	// first.
+	GetCaseHistory(ctx context.Context, id string) ([]models.CaseRevisionModel, error)
+
+	// GetCase returns a case whatever its status.
+	GetCase(ctx context.Context, id string) (models.CaseModel, error)
+	// GetCases lists the cases of a status, the most recently changed first.
+	GetCases(ctx context.Context, status string, page int64, perPage int64) (commonModels.BasePaginationResponse, error)
+	// CreateCase stores a new case as a draft.
+	CreateCase(ctx context.Context, actor string, fields models.CaseFields) (models.CaseModel, error)
+	// UpdateCase replaces the fields of a draft or validated case.
+	UpdateCase(ctx context.Context, actor string, id string, caseRequest models.CaseRequest) (models.CaseModel, error)
+	// ValidateCase publishes a draft.
+	ValidateCase(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error)
+	// DeleteCase soft deletes a draft or validated case.
+	DeleteCase(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error)
+	// RestoreCase brings a deleted case back as a draft.
+	RestoreCase(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error)
+	// ImportCases upserts a batch of cases as drafts.
+	ImportCases(ctx context.Context, actor string, records []json.RawMessage) (models.CaseImportReport, error)
 }
@@ -0,0 +1,99 @@
+package bo_v1
+
+import (
+	"context"
+	"encoding/json"
+	"lexicon/bo-api/common/cache"
+	"lexicon/bo-api/common/utils"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// cache namespaces of the public endpoints
+const (
+	cacheChart     = "chart"
+	cacheLkppChart = "lkpp-chart"
+	cacheSearch    = "search"
+	cacheDetail    = "detail"
+)
+
+// CacheTTLs is how long each kind of response is cached, 0 to not cache it.
+type CacheTTLs struct {
+	Chart  time.Duration
+	Detail time.Duration
+	Search time.Duration
+}
+
+// ResponseCache keeps the encoded responses of the charts, the details and
+// the searches, which are all read from the cases.
+type ResponseCache struct {
+	cache *cache.Cache
+	ttls  CacheTTLs
+}
+
+func NewResponseCache(c *cache.Cache, ttls CacheTTLs) *ResponseCache {
+	return &ResponseCache{cache: c, ttls: ttls}
+}
+
+// InvalidateCases is the hook of case writes. Any case can change the charts
+// and the searches, so they are dropped whole, and the details of the cases
+// written. The responses are left to expire when the cache fails.
+func (c *ResponseCache) InvalidateCases(ctx context.Context, ids []string) {
+	if err := c.cache.Invalidate(ctx, cacheChart, cacheLkppChart, cacheSearch); err != nil {
+		log.Error().Err(err).Msg("Error invalidating cached responses")
+	}
+
+	for _, id := range ids {
+		if err := c.cache.Forget(ctx, cacheDetail, id); err != nil {
+			log.Error().Err(err).Str("id", id).Msg("Error invalidating cached detail")
+		}
+	}
+}
+
+// InvalidateCharts is the hook of aggregate refreshes, the charts read from
+// the aggregates.
+func (c *ResponseCache) InvalidateCharts(ctx context.Context) {
+	if err := c.cache.Invalidate(ctx, cacheChart, cacheLkppChart); err != nil {
+		log.Error().Err(err).Msg("Error invalidating cached charts")
+	}
+}
+
+// InvalidateAll is the hook of the bulk writes that go around the case
+// service, the seed and the graph rebuild, every cached response is dropped.
+func (c *ResponseCache) InvalidateAll(ctx context.Context) {
+	if err := c.cache.Invalidate(ctx, cacheChart, cacheLkppChart, cacheSearch, cacheDetail); err != nil {
+		log.Error().Err(err).Msg("Error invalidating cached responses")
+	}
+}
+
+// serve writes the response load returns, kept under key for ttl, with an
+// ETag. The error of load is returned for the handler to write.
+func (c *ResponseCache) serve(w http.ResponseWriter, r *http.Request, namespace string, key string, ttl time.Duration, load func() (any, error)) error {
+	encode := func() ([]byte, error) {
+		response, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(response)
+	}
+
+	var body []byte
+	var err error
+
+	if ttl > 0 {
+		body, err = c.cache.Fetch(r.Context(), namespace, key, ttl, encode)
+	} else {
+		body, err = encode()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	utils.WriteETag(w, r, body)
+
+	return nil
+}
@@ -1,37 +1,124 @@
 package bo_v1
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	models "lexicon/bo-api/beneficiary_ownership/v1/models"
 	bo_v1_services "lexicon/bo-api/beneficiary_ownership/v1/services"
+	"lexicon/bo-api/common/metrics"
+	commonModels "lexicon/bo-api/common/models"
 	"lexicon/bo-api/common/utils"
+	"lexicon/bo-api/middlewares"
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/jackc/pgx/v5"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
 )
 
-func Router() *chi.Mux {
+// caseHandlers serve the endpoints reading cases from the case service, the
+// charts, details and searches through the response cache. Only the details,
+// their history, the chatbot references and the admin cases go through the
+// case repository and can be served from memory. The searches, exports,
+// charts, graph, entities, screening and watchlists read the database
+// directly and are out of its scope.
+type caseHandlers struct {
+	cases     *bo_v1_services.CaseService
+	responses *ResponseCache
+}
+
+// requestTimeout bounds a request. An export streams every matching row and
+// has exportTimeout instead, a deadline can only be shortened by a nested one.
+const (
+	requestTimeout = 2 * time.Minute
+	exportTimeout  = 30 * time.Minute
+)
+
+// Router serves the public endpoints, each group of routes needs the scope
+// of its kind of data. Searches, graphs, exports, screening and the chatbot
+// are rate limited.
+func Router(cases *bo_v1_services.CaseService, limiter *middlewares.RateLimiter, responses *ResponseCache) *chi.Mux {
+	h := caseHandlers{cases: cases, responses: responses}
 
 	r := chi.NewMux()
-	r.Get("/search", searchHandler)
-	r.Get("/detail/{id}", detailHandler)
-	r.Get("/chart", chartHandler)
-	r.Get("/lkpp-chart", lkppCharthandler)
-	r.Post("/chatbot", chatbotHandler)
-	r.Post("/chatbot/references", chatbotReferenceHandler)
+
+	r.With(
+		middleware.Timeout(exportTimeout),
+		middlewares.RequireScope(models.ScopeSearch),
+		limiter.Limit(middlewares.RateLimitExport),
+	).Get("/search/export", searchExportHandler)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(requestTimeout))
+
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RequireScope(models.ScopeSearch))
+			r.With(limiter.Limit(middlewares.RateLimitSearch)).Get("/search", h.searchHandler)
+			r.Get("/chart", h.chartHandler)
+			r.Get("/lkpp-chart", h.lkppCharthandler)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RequireScope(models.ScopeDetail))
+			r.Get("/detail/{id}", h.detailHandler)
+			r.Get("/detail/{id}/history", h.caseHistoryHandler(false))
+			r.With(limiter.Limit(middlewares.RateLimitSearch)).Get("/graph/{id}", graphHandler)
+			r.Get("/entities/{id}", entityHandler)
+		})
+
+		r.With(
+			middlewares.RequireScope(models.ScopeScreening),
+			limiter.LimitCost(middlewares.RateLimitScreening, screeningCost),
+		).Post("/screen", screenHandler)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RequireScope(models.ScopeWatchlists))
+			r.Get("/watchlists", watchlistsHandler)
+			r.Post("/watchlists", createWatchlistHandler)
+			r.Get("/watchlists/{id}", watchlistHandler)
+			r.Put("/watchlists/{id}", updateWatchlistHandler)
+			r.Delete("/watchlists/{id}", deleteWatchlistHandler)
+			r.Post("/watchlists/{id}/secret", rotateWatchlistSecretHandler)
+			r.Get("/watchlists/{id}/deliveries", watchlistDeliveriesHandler)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RequireScope(models.ScopeChatbot))
+			r.Use(limiter.Limit(middlewares.RateLimitChatbot))
+			r.Post("/chatbot", chatbotHandler)
+			r.Post("/chatbot/references", h.chatbotReferenceHandler)
+		})
+	})
 	return r
 }
 
-func searchHandler(w http.ResponseWriter, r *http.Request) {
+// callerIdentity is who a request acts as, the client its key was issued to.
+// The consumers of a shared key of the config are told apart by the
+// X-REQUEST-IDENTITY they send, it only ever narrows the client down.
+func callerIdentity(r *http.Request) string {
+	caller, _ := middlewares.CallerFromContext(r.Context())
 
-	qp := r.URL.Query()
+	if caller.Shared {
+		return caller.ClientID + ":" + r.Header.Get("X-REQUEST-IDENTITY")
+	}
+
+	return caller.ClientID
+}
+
+// parseSearchFilters reads the filters shared by every endpoint that queries
+// the search index.
+func parseSearchFilters(qp url.Values) (models.SearchRequest, error) {
 	query := qp.Get("query")
 	rawSubjectType := qp.Get("subject_type")
 	var subjectTypes []string
@@ -50,36 +137,42 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	nations := strings.Split(qp.Get("nation"), ",")
-	page := qp.Get("page")
 
 	years := []string{}
 
-	pageInt, err := strconv.Atoi(page)
-
+	sort, err := models.ParseSearchSort(qp.Get("sort"))
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, errors.New("page must be a number"))
-		return
+		return models.SearchRequest{}, err
+	}
+
+	match := qp.Get("match")
+	if match != "" && match != "exact" && match != "fuzzy" {
+		return models.SearchRequest{}, errors.New("match must be one of exact, fuzzy")
+	}
+
+	var minScore float64
+
+	if rawMinScore := qp.Get("min_score"); rawMinScore != "" {
+		minScore, err = strconv.ParseFloat(rawMinScore, 64)
+		if err != nil || minScore <= 0 || minScore > 1 {
+			return models.SearchRequest{}, errors.New("min_score must be a number between 0 and 1")
+		}
 	}
 
 	if year != "" {
 		yearsSplit := strings.Split(year, "-")
 		if len(yearsSplit) != 2 {
-			utils.WriteError(w, http.StatusBadRequest, errors.New("year must be in the format of year-year"))
-
-			return
+			return models.SearchRequest{}, errors.New("year must be in the format of year-year")
 		}
 		// genereate year between
 		yearFrom, err := strconv.Atoi(yearsSplit[0])
 		if err != nil {
-			utils.WriteError(w, http.StatusBadRequest, errors.New("year must be in the format of year-year"))
-			return
+			return models.SearchRequest{}, errors.New("year must be in the format of year-year")
 		}
 		yearTo, err := strconv.Atoi(yearsSplit[1])
 
 		if err != nil {
-			utils.WriteError(w, http.StatusBadRequest, errors.New("year must be in the format of year-year"))
-
-			return
+			return models.SearchRequest{}, errors.New("year must be in the format of year-year")
 		}
 
 		for i := yearFrom; i <= yearTo; i++ {
@@ -94,26 +187,386 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 		Years:        years,
 		Types:        caseTypes,
 		Nations:      nations,
-		Page:         int64(pageInt),
+		Match:        match,
+		MinScore:     minScore,
+		Sort:         sort,
+	}
+
+	return req, nil
+}
+
+func (h caseHandlers) searchHandler(w http.ResponseWriter, r *http.Request) {
+
+	qp := r.URL.Query()
+
+	req, err := parseSearchFilters(qp)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page := qp.Get("page")
+	perPage := models.DefaultSearchPerPage
+
+	if rawPerPage := qp.Get("per_page"); rawPerPage != "" {
+		perPage, err = strconv.Atoi(rawPerPage)
+
+		if err != nil || perPage < 1 || perPage > models.MaxSearchPerPage {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("per_page must be a number between 1 and %d", models.MaxSearchPerPage))
+			return
+		}
+	}
+
+	var cursor *models.SearchCursor
+	pageInt := 1
+
+	// cursor takes precedence over page, an empty cursor starts from the first row
+	if qp.Has("cursor") {
+		decoded, err := models.DecodeSearchCursor(qp.Get("cursor"))
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if !decoded.IsStart() && decoded.Sort != req.Sort.String() {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("cursor does not match sort"))
+			return
+		}
+		cursor = &decoded
+	} else {
+		pageInt, err = strconv.Atoi(page)
+
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("page must be a number"))
+			return
+		}
+	}
+
+	if rawFacets := qp.Get("facets"); rawFacets != "" {
+		for _, facet := range strings.Split(rawFacets, ",") {
+			if !models.IsSearchFacet(facet) {
+				utils.WriteError(w, http.StatusBadRequest, errors.New("facets must be a list of nation, subject_type, case_type, year"))
+				return
+			}
+
+			if !slices.Contains(req.Facets, facet) {
+				req.Facets = append(req.Facets, facet)
+			}
+		}
+	}
+
+	req.Page = int64(pageInt)
+	req.PerPage = int64(perPage)
+	req.Cursor = cursor
+
+	// an empty search is not cached, it is answered with a 404
+	err = h.responses.serve(w, r, cacheSearch, utils.CanonicalQuery(qp), h.responses.ttls.Search, func() (any, error) {
+		response, err := bo_v1_services.Search(r.Context(), req)
+		if err == nil && response.Data == nil {
+			return nil, pgx.ErrNoRows
+		}
+		return response, err
+	})
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
+		return
 	}
 
-	response, err := bo_v1_services.Search(r.Context(), req)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+}
+
+func searchExportHandler(w http.ResponseWriter, r *http.Request) {
+
+	qp := r.URL.Query()
+
+	req, err := parseSearchFilters(qp)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	format := qp.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	var writer models.ExportWriter
+	response := &exportResponse{w: w}
+
+	switch format {
+	case "csv":
+		response.contentType = "text/csv"
+		response.filename = "search-export.csv"
+		writer = models.NewCSVExportWriter(response)
+	case "ndjson":
+		response.contentType = "application/x-ndjson"
+		response.filename = "search-export.ndjson"
+		writer = models.NewNDJSONExportWriter(response)
+	default:
+		utils.WriteError(w, http.StatusBadRequest, errors.New("format must be one of csv, ndjson"))
+		return
+	}
+
+	err = bo_v1_services.ExportSearch(r.Context(), req, writer)
 
-	if response.Data == nil {
+	// until the first bytes go out a failure is still a 500, after it can
+	// only be logged and the stream cut short
+	if err != nil && !response.committed {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error exporting search results")
+		return
+	}
+
+	// an empty NDJSON export writes nothing
+	response.commit()
+}
+
+// exportResponse sends the status and the download headers of an export with
+// its first bytes, which the writers buffer until the query returned rows.
+type exportResponse struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	committed   bool
+}
+
+func (e *exportResponse) commit() {
+	if e.committed {
+		return
+	}
+
+	e.w.Header().Set("Content-Type", e.contentType)
+	e.w.Header().Set("Content-Disposition", `attachment; filename="`+e.filename+`"`)
+	e.w.WriteHeader(http.StatusOK)
+	e.committed = true
+}
+
+func (e *exportResponse) Write(p []byte) (int, error) {
+	e.commit()
+	return e.w.Write(p)
+}
+
+func (h caseHandlers) detailHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	err := h.responses.serve(w, r, cacheDetail, id, h.responses.ttls.Detail, func() (any, error) {
+		response, err := h.cases.GetDetail(r.Context(), id)
+		return commonModels.BaseResponse{Data: response}, err
+	})
+
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
+		return
+	}
+}
+
+// caseHistoryHandler serves the revisions of a case. The curators who wrote
+// them are only named to admins.
+func (h caseHandlers) caseHistoryHandler(withActors bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+
+		response, err := h.cases.GetCaseHistory(r.Context(), id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
+			return
+		}
+
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !withActors {
+			for i := range response {
+				response[i].Actor = ""
+			}
+		}
+
+		utils.WriteData(w, response, http.StatusOK)
+	}
+}
+
+func graphHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	hops := models.DefaultGraphHops
+
+	if rawHops := r.URL.Query().Get("hops"); rawHops != "" {
+		var err error
+		hops, err = strconv.Atoi(rawHops)
+
+		if err != nil || hops < 1 || hops > models.MaxGraphHops {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("hops must be a number between 1 and %d", models.MaxGraphHops))
+			return
+		}
+	}
+
+	response, err := bo_v1_services.GetGraph(r.Context(), id, hops)
+	if errors.Is(err, models.ErrGraphRootNotFound) {
+		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
+		return
+	}
+
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteData(w, response, http.StatusOK)
+}
+
+func entityHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	response, err := bo_v1_services.GetEntity(r.Context(), id)
+	if err != nil {
 		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
 		return
 	}
-	utils.WriteResponse(w, response, http.StatusOK)
+
+	utils.WriteData(w, response, http.StatusOK)
+}
+
+// maxScreeningCostBytes is how much of a screening body is read to count its
+// inputs, a larger body costs the most a batch can.
+const maxScreeningCostBytes = 1 << 20
+
+// screeningCost is the number of names a screening request screens. The body
+// is read ahead of the handler and put back for it.
+func screeningCost(r *http.Request) int {
+	head, err := io.ReadAll(io.LimitReader(r.Body, maxScreeningCostBytes+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+
+	if err != nil || len(head) > maxScreeningCostBytes {
+		return models.MaxScreeningInputs
+	}
+
+	var req struct {
+		Inputs []json.RawMessage `json:"inputs"`
+	}
+
+	if json.Unmarshal(head, &req) != nil {
+		return 1
+	}
+
+	return len(req.Inputs)
+}
+
+func screenHandler(w http.ResponseWriter, r *http.Request) {
+	req := models.ScreeningRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding request body")
+		utils.WriteError(w, http.StatusBadRequest, errors.New("body is empty"))
+		return
+	}
+	defer r.Body.Close()
+
+	if len(req.Inputs) == 0 || len(req.Inputs) > models.MaxScreeningInputs {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("inputs must contain between 1 and %d names", models.MaxScreeningInputs))
+		return
+	}
+
+	if req.Limit < 0 || req.Limit > models.MaxScreeningLimit {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be a number between 1 and %d, or 0 for the default of %d", models.MaxScreeningLimit, models.DefaultScreeningLimit))
+		return
+	}
+
+	if req.MinScore < 0 || req.MinScore > 1 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("min_score must be a number between 0 and 1"))
+		return
+	}
+
+	for i, input := range req.Inputs {
+		if strings.TrimSpace(input.Name) == "" {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("inputs[%d].name is required", i))
+			return
+		}
+
+		if input.SubjectType != "" && input.SubjectType != "individual" && input.SubjectType != "company" && input.SubjectType != "organization" {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("inputs[%d].subject_type must be one of individual, company, organization", i))
+			return
+		}
+
+		if input.DateOfBirth != "" {
+			if _, err := time.Parse("2006-01-02", input.DateOfBirth); err != nil {
+				utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("inputs[%d].date_of_birth must be in the format of YYYY-MM-DD", i))
+				return
+			}
+		}
+	}
+
+	response, err := bo_v1_services.Screen(r.Context(), req)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteData(w, response, http.StatusOK)
+}
+
+// decodeWatchlistRequest reads and validates the body of a watchlist write.
+func decodeWatchlistRequest(r *http.Request) (models.WatchlistRequest, error) {
+	req := models.WatchlistRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding request body")
+		return req, errors.New("body is empty")
+	}
+	defer r.Body.Close()
+
+	if err = req.Validate(); err != nil {
+		return req, err
+	}
+
+	if err = bo_v1_services.ValidateWebhookURL(r.Context(), req.WebhookURL); err != nil {
+		return req, err
+	}
+
+	return req, nil
 }
 
-func detailHandler(w http.ResponseWriter, r *http.Request) {
+func watchlistsHandler(w http.ResponseWriter, r *http.Request) {
+	response, err := bo_v1_services.GetWatchlists(r.Context(), callerIdentity(r))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteData(w, response, http.StatusOK)
+}
+
+func createWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeWatchlistRequest(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response, err := bo_v1_services.CreateWatchlist(r.Context(), callerIdentity(r), req)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteData(w, response, http.StatusCreated)
+}
+
+func watchlistHandler(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	response, err := bo_v1_services.GetDetail(r.Context(), id)
+	response, err := bo_v1_services.GetWatchlist(r.Context(), callerIdentity(r), id)
 	if err != nil {
 		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
 		return
@@ -122,26 +575,206 @@ func detailHandler(w http.ResponseWriter, r *http.Request) {
 	utils.WriteData(w, response, http.StatusOK)
 }
 
-func chartHandler(w http.ResponseWriter, r *http.Request) {
-	response, err := bo_v1_services.GetChartData(r.Context())
+func updateWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	req, err := decodeWatchlistRequest(r)
 	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response, err := bo_v1_services.UpdateWatchlist(r.Context(), callerIdentity(r), id, req)
+	if errors.Is(err, pgx.ErrNoRows) {
 		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
 		return
 	}
 
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
 	utils.WriteData(w, response, http.StatusOK)
 }
 
-func lkppCharthandler(w http.ResponseWriter, r *http.Request) {
-	response, err := bo_v1_services.GetLkppChartData(r.Context())
+func deleteWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	err := bo_v1_services.DeleteWatchlist(r.Context(), callerIdentity(r), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
+		return
+	}
+
 	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteMessage(w, http.StatusOK, "watchlist deleted")
+}
+
+func rotateWatchlistSecretHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	response, err := bo_v1_services.RotateWatchlistSecret(r.Context(), callerIdentity(r), id)
+	if errors.Is(err, pgx.ErrNoRows) {
 		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
 		return
 	}
 
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteData(w, response, http.StatusOK)
+}
+
+func watchlistDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	response, err := bo_v1_services.GetWatchlistDeliveries(r.Context(), callerIdentity(r), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
+		return
+	}
+
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
 	utils.WriteData(w, response, http.StatusOK)
 }
 
+func (h caseHandlers) chartHandler(w http.ResponseWriter, r *http.Request) {
+	qp := r.URL.Query()
+
+	req, err := parseSearchFilters(qp)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// drafts and deleted cases are not public, only an admin charts them
+	if rawStatus := qp.Get("status"); rawStatus != "" {
+		caller, _ := middlewares.CallerFromContext(r.Context())
+
+		for _, status := range strings.Split(rawStatus, ",") {
+			if !models.IsCaseStatus(status) {
+				utils.WriteError(w, http.StatusBadRequest, errors.New("status must be a list of validated, draft, deleted"))
+				return
+			}
+
+			if status != "validated" && !caller.HasScope(models.ScopeAdmin) {
+				utils.WriteError(w, http.StatusForbidden, fmt.Errorf("status %s needs the %s scope", status, models.ScopeAdmin))
+				return
+			}
+
+			req.Statuses = append(req.Statuses, status)
+		}
+	}
+
+	err = h.responses.serve(w, r, cacheChart, utils.CanonicalQuery(qp), h.responses.ttls.Chart, func() (any, error) {
+		response, err := bo_v1_services.GetChartData(r.Context(), req)
+		return commonModels.BaseResponse{Data: response}, err
+	})
+
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
+		return
+	}
+}
+
+// parseLkppChartRequest reads the period as from and to dates, a list of
+// provinces, the ceiling bucket bounds and the size of the top lists.
+func parseLkppChartRequest(qp url.Values) (models.LkppChartRequest, error) {
+	var req models.LkppChartRequest
+	var err error
+
+	if req.From, err = parseDateParam(qp, "from"); err != nil {
+		return req, err
+	}
+
+	if req.To, err = parseDateParam(qp, "to"); err != nil {
+		return req, err
+	}
+
+	if rawProvince := qp.Get("province"); rawProvince != "" {
+		req.Provinces = strings.Split(rawProvince, ",")
+	}
+
+	if rawBuckets := qp.Get("buckets"); rawBuckets != "" {
+		for _, rawBound := range strings.Split(rawBuckets, ",") {
+			bound, err := strconv.ParseInt(rawBound, 10, 64)
+			if err != nil {
+				return req, errors.New("buckets must be a list of amounts")
+			}
+			req.CeilingBuckets = append(req.CeilingBuckets, bound)
+		}
+	}
+
+	if req.TopReporters, err = parseTopParam(qp, "top"); err != nil {
+		return req, err
+	}
+
+	if req.TopViolations, err = parseTopParam(qp, "top_violations"); err != nil {
+		return req, err
+	}
+
+	return req, req.Validate()
+}
+
+func parseDateParam(qp url.Values, param string) (null.Time, error) {
+	raw := qp.Get(param)
+	if raw == "" {
+		return null.Time{}, nil
+	}
+
+	date, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return null.Time{}, errors.New(param + " must be a date in the format of YYYY-MM-DD")
+	}
+
+	return null.TimeFrom(date), nil
+}
+
+func parseTopParam(qp url.Values, param string) (int, error) {
+	raw := qp.Get(param)
+	if raw == "" {
+		return 0, nil
+	}
+
+	top, err := strconv.Atoi(raw)
+	if err != nil || top <= 0 {
+		return 0, errors.New(param + " must be a positive number")
+	}
+
+	return top, nil
+}
+
+func (h caseHandlers) lkppCharthandler(w http.ResponseWriter, r *http.Request) {
+	qp := r.URL.Query()
+
+	req, err := parseLkppChartRequest(qp)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.responses.serve(w, r, cacheLkppChart, utils.CanonicalQuery(qp), h.responses.ttls.Chart, func() (any, error) {
+		response, err := bo_v1_services.GetLkppChartData(r.Context(), req)
+		return commonModels.BaseResponse{Data: response}, err
+	})
+
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
+		return
+	}
+}
+
 func chatbotHandler(w http.ResponseWriter, r *http.Request) {
 	req := models.ChatbotRequest{}
 	err := json.NewDecoder(r.Body).Decode(&req)
@@ -185,12 +818,19 @@ func chatbotHandler(w http.ResponseWriter, r *http.Request) {
 	log.Info().Msgf("Chatbot curl equivalent: %s", curlCmd)
 
 	log.Info().Msgf("Chatbot request: %s", chatReq.URL.String())
+	start := time.Now()
 	chatResp, err := utils.Client.Do(chatReq)
+	metrics.ChatbotRequestDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
+		metrics.ChatbotErrors.Inc()
 		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
 		return
 	}
 
+	if chatResp.StatusCode >= http.StatusInternalServerError {
+		metrics.ChatbotErrors.Inc()
+	}
+
 	defer chatResp.Body.Close()
 
 	response := models.ChatbotResponse{}
@@ -205,7 +845,7 @@ func chatbotHandler(w http.ResponseWriter, r *http.Request) {
 	utils.WriteData(w, response, http.StatusOK)
 }
 
-func chatbotReferenceHandler(w http.ResponseWriter, r *http.Request) {
+func (h caseHandlers) chatbotReferenceHandler(w http.ResponseWriter, r *http.Request) {
 	req := models.ChatbotReferenceRequest{}
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
@@ -226,7 +866,7 @@ func chatbotReferenceHandler(w http.ResponseWriter, r *http.Request) {
 		os.Getenv("CHATBOT_BASE_URL"), apiKey, string(reqBody))
 	log.Info().Msgf("Chatbot references curl equivalent: %s", curlCmd)
 
-	urls, err := bo_v1_services.GetUrlByCaseNumber(r.Context(), req.CaseNumbers)
+	urls, err := h.cases.GetUrlByCaseNumber(r.Context(), req.CaseNumbers)
 	if err != nil {
 		log.Error().Err(err).Msg("Error getting urls")
 		utils.WriteError(w, http.StatusNotFound, errors.New("data not found"))
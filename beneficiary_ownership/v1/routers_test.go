@@ -0,0 +1,449 @@
+package bo_v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+	bo_v1_repositories "lexicon/bo-api/beneficiary_ownership/v1/repositories"
+	bo_v1_services "lexicon/bo-api/beneficiary_ownership/v1/services"
+	"lexicon/bo-api/common/cache"
+	"lexicon/bo-api/common/utils"
+	"lexicon/bo-api/middlewares"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/oklog/ulid/v2"
+	"gopkg.in/guregu/null.v4"
+)
+
+const testSalt = "test-salt"
+
+// api keys of the test server and the callers they authenticate
+var testCallers = map[string]middlewares.ApiCaller{
+	"public-key": {ClientID: "public-client", Name: "public", Scopes: models.PublicScopes},
+	"search-key": {ClientID: "search-client", Name: "search", Scopes: []string{models.ScopeSearch}},
+	"admin-key":  {ClientID: "admin-client", Name: "admin", Scopes: []string{models.ScopeAdmin}},
+	"shared-key": {ClientID: "api-key", Name: "api-key", Scopes: models.PublicScopes, Shared: true},
+}
+
+type testApiKeyStore struct{}
+
+func (testApiKeyStore) ResolveApiKey(ctx context.Context, hashedKey string) (middlewares.ApiCaller, error) {
+	for key, caller := range testCallers {
+		if utils.HashApiKey(testSalt, key) == hashedKey {
+			return caller, nil
+		}
+	}
+
+	return middlewares.ApiCaller{}, middlewares.ErrUnknownApiKey
+}
+
+// newTestServer mounts the public and admin routers as the server does, over
+// a case service reading the given cases from memory.
+func newTestServer(t *testing.T, cases ...models.CaseModel) *httptest.Server {
+	t.Helper()
+
+	service := bo_v1_services.NewCaseService(bo_v1_repositories.NewMemoryCaseRepository(cases...))
+	responses := NewResponseCache(cache.New(cache.NewMemoryStore(100)), CacheTTLs{Chart: time.Minute, Detail: time.Minute, Search: time.Minute})
+	service.OnCaseChange(responses.InvalidateCases)
+
+	limiter := middlewares.NewRateLimiter(middlewares.NewMemoryRateLimitStore(), nil)
+
+	r := chi.NewRouter()
+	r.Use(middlewares.ApiKey(testApiKeyStore{}, testSalt))
+	r.Mount("/v1/beneficiary-ownership", Router(service, limiter, responses))
+	r.Mount("/v1/admin", AdminRouter(service, bo_v1_services.NewApiKeyStore(), testSalt))
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+type testResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func doRequest(t *testing.T, server *httptest.Server, method string, path string, apiKey string, body any, header http.Header) testResponse {
+	t.Helper()
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-REQUEST-IDENTITY", "tester")
+	req.Header.Set("X-API-KEY", apiKey)
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	var buf bytes.Buffer
+	if _, err = buf.ReadFrom(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+
+	return testResponse{status: resp.StatusCode, header: resp.Header, body: buf.Bytes()}
+}
+
+// decodeData decodes the data field of a response into v.
+func decodeData(t *testing.T, resp testResponse, v any) {
+	t.Helper()
+
+	envelope := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+
+	if err := json.Unmarshal(resp.body, &envelope); err != nil {
+		t.Fatalf("decoding %s: %v", resp.body, err)
+	}
+
+	if err := json.Unmarshal(envelope.Data, v); err != nil {
+		t.Fatalf("decoding %s: %v", envelope.Data, err)
+	}
+}
+
+func testCaseFields(subject string) models.CaseFields {
+	return models.CaseFields{
+		Subject:        subject,
+		SubjectType:    "company",
+		DecisionNumber: null.StringFrom("123/PID/2023"),
+		Source:         "court",
+		Link:           "https://example.com/decision",
+		Nation:         "Indonesia",
+		Type:           "verdict",
+		Year:           "2023",
+		Summary:        "summary of the decision",
+	}
+}
+
+func TestDetailHandler(t *testing.T) {
+	validated := models.CaseModel{ID: ulid.Make(), CaseFields: testCaseFields("PT ABC"), Status: "validated"}
+	draft := models.CaseModel{ID: ulid.Make(), CaseFields: testCaseFields("PT DRAFT"), Status: "draft"}
+
+	server := newTestServer(t, validated, draft)
+
+	tests := []struct {
+		name   string
+		id     string
+		apiKey string
+		status int
+	}{
+		{"validated case", validated.ID.String(), "public-key", http.StatusOK},
+		{"draft case", draft.ID.String(), "public-key", http.StatusNotFound},
+		{"unknown case", ulid.Make().String(), "public-key", http.StatusNotFound},
+		{"without the detail scope", validated.ID.String(), "search-key", http.StatusForbidden},
+		{"unknown key", validated.ID.String(), "wrong-key", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(t, server, http.MethodGet, "/v1/beneficiary-ownership/detail/"+tt.id, tt.apiKey, nil, nil)
+
+			if resp.status != tt.status {
+				t.Fatalf("status = %d, want %d: %s", resp.status, tt.status, resp.body)
+			}
+		})
+	}
+
+	t.Run("served with an etag", func(t *testing.T) {
+		resp := doRequest(t, server, http.MethodGet, "/v1/beneficiary-ownership/detail/"+validated.ID.String(), "public-key", nil, nil)
+
+		var detail models.DetailResultModel
+		decodeData(t, resp, &detail)
+
+		if detail.Subject != "PT ABC" {
+			t.Errorf("subject = %q, want %q", detail.Subject, "PT ABC")
+		}
+
+		etag := resp.header.Get("ETag")
+		if etag == "" {
+			t.Fatal("ETag is not set")
+		}
+
+		resp = doRequest(t, server, http.MethodGet, "/v1/beneficiary-ownership/detail/"+validated.ID.String(), "public-key", nil, http.Header{"If-None-Match": {etag}})
+
+		if resp.status != http.StatusNotModified {
+			t.Errorf("status = %d, want %d", resp.status, http.StatusNotModified)
+		}
+	})
+}
+
+func TestCaseHistoryHandlers(t *testing.T) {
+	server := newTestServer(t)
+
+	resp := doRequest(t, server, http.MethodPost, "/v1/admin/cases", "admin-key", testCaseFields("PT ABC"), nil)
+	if resp.status != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", resp.status, resp.body)
+	}
+
+	var created models.CaseModel
+	decodeData(t, resp, &created)
+
+	id := created.ID.String()
+
+	// drafts have no public history yet
+	resp = doRequest(t, server, http.MethodGet, "/v1/beneficiary-ownership/detail/"+id+"/history", "public-key", nil, nil)
+	if resp.status != http.StatusNotFound {
+		t.Fatalf("draft history status = %d, want %d", resp.status, http.StatusNotFound)
+	}
+
+	resp = doRequest(t, server, http.MethodPost, "/v1/admin/cases/"+id+"/validate", "admin-key", models.CaseTransitionRequest{UpdatedAt: created.UpdatedAt}, nil)
+	if resp.status != http.StatusOK {
+		t.Fatalf("validate status = %d: %s", resp.status, resp.body)
+	}
+
+	t.Run("public", func(t *testing.T) {
+		resp := doRequest(t, server, http.MethodGet, "/v1/beneficiary-ownership/detail/"+id+"/history", "public-key", nil, nil)
+		if resp.status != http.StatusOK {
+			t.Fatalf("status = %d: %s", resp.status, resp.body)
+		}
+
+		var revisions []map[string]json.RawMessage
+		decodeData(t, resp, &revisions)
+
+		if len(revisions) != 2 {
+			t.Fatalf("got %d revisions, want 2", len(revisions))
+		}
+
+		for _, revision := range revisions {
+			if actor, ok := revision["actor"]; ok {
+				t.Errorf("public revision names its actor %s", actor)
+			}
+		}
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		resp := doRequest(t, server, http.MethodGet, "/v1/admin/cases/"+id+"/history", "admin-key", nil, nil)
+		if resp.status != http.StatusOK {
+			t.Fatalf("status = %d: %s", resp.status, resp.body)
+		}
+
+		var revisions []models.CaseRevisionModel
+		decodeData(t, resp, &revisions)
+
+		if len(revisions) != 2 {
+			t.Fatalf("got %d revisions, want 2", len(revisions))
+		}
+
+		if revisions[0].Action != models.CaseCreated || revisions[1].Action != models.CaseValidated {
+			t.Errorf("actions = %q, %q, want %q, %q", revisions[0].Action, revisions[1].Action, models.CaseCreated, models.CaseValidated)
+		}
+
+		// the actor is the client of the key, not the X-REQUEST-IDENTITY sent
+		for _, revision := range revisions {
+			if revision.Actor != "admin-client" {
+				t.Errorf("actor = %q, want %q", revision.Actor, "admin-client")
+			}
+		}
+	})
+
+	t.Run("admin without the admin scope", func(t *testing.T) {
+		resp := doRequest(t, server, http.MethodGet, "/v1/admin/cases/"+id+"/history", "public-key", nil, nil)
+		if resp.status != http.StatusForbidden {
+			t.Fatalf("status = %d, want %d", resp.status, http.StatusForbidden)
+		}
+	})
+}
+
+func TestAdminCaseRoutes(t *testing.T) {
+	server := newTestServer(t)
+
+	t.Run("invalid case", func(t *testing.T) {
+		fields := testCaseFields("PT ABC")
+		fields.Year = "23"
+
+		resp := doRequest(t, server, http.MethodPost, "/v1/admin/cases", "admin-key", fields, nil)
+		if resp.status != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", resp.status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("without the admin scope", func(t *testing.T) {
+		resp := doRequest(t, server, http.MethodPost, "/v1/admin/cases", "public-key", testCaseFields("PT ABC"), nil)
+		if resp.status != http.StatusForbidden {
+			t.Fatalf("status = %d, want %d", resp.status, http.StatusForbidden)
+		}
+	})
+
+	resp := doRequest(t, server, http.MethodPost, "/v1/admin/cases", "admin-key", testCaseFields("PT ABC"), nil)
+	if resp.status != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", resp.status, resp.body)
+	}
+
+	var created models.CaseModel
+	decodeData(t, resp, &created)
+
+	id := created.ID.String()
+
+	if created.Status != "draft" {
+		t.Errorf("created status = %q, want draft", created.Status)
+	}
+
+	resp = doRequest(t, server, http.MethodGet, "/v1/admin/cases?status=draft", "admin-key", nil, nil)
+	if resp.status != http.StatusOK {
+		t.Fatalf("list status = %d: %s", resp.status, resp.body)
+	}
+
+	var drafts []models.CaseModel
+	decodeData(t, resp, &drafts)
+
+	if len(drafts) != 1 || drafts[0].ID != created.ID {
+		t.Errorf("drafts = %v, want the created case", drafts)
+	}
+
+	update := models.CaseRequest{CaseFields: testCaseFields("PT ABC Tbk"), UpdatedAt: created.UpdatedAt}
+
+	resp = doRequest(t, server, http.MethodPut, "/v1/admin/cases/"+id, "admin-key", update, nil)
+	if resp.status != http.StatusOK {
+		t.Fatalf("update status = %d: %s", resp.status, resp.body)
+	}
+
+	var updated models.CaseModel
+	decodeData(t, resp, &updated)
+
+	// the updated_at of the create is stale now
+	resp = doRequest(t, server, http.MethodPut, "/v1/admin/cases/"+id, "admin-key", update, nil)
+	if resp.status != http.StatusConflict {
+		t.Fatalf("stale update status = %d, want %d", resp.status, http.StatusConflict)
+	}
+
+	resp = doRequest(t, server, http.MethodPost, "/v1/admin/cases/"+id+"/restore", "admin-key", models.CaseTransitionRequest{UpdatedAt: updated.UpdatedAt}, nil)
+	if resp.status != http.StatusUnprocessableEntity {
+		t.Fatalf("restore of a draft status = %d, want %d", resp.status, http.StatusUnprocessableEntity)
+	}
+
+	resp = doRequest(t, server, http.MethodPost, "/v1/admin/cases/"+id+"/validate", "admin-key", models.CaseTransitionRequest{UpdatedAt: updated.UpdatedAt}, nil)
+	if resp.status != http.StatusOK {
+		t.Fatalf("validate status = %d: %s", resp.status, resp.body)
+	}
+
+	var validated models.CaseModel
+	decodeData(t, resp, &validated)
+
+	resp = doRequest(t, server, http.MethodGet, "/v1/beneficiary-ownership/detail/"+id, "public-key", nil, nil)
+	if resp.status != http.StatusOK {
+		t.Fatalf("detail of the validated case status = %d: %s", resp.status, resp.body)
+	}
+
+	resp = doRequest(t, server, http.MethodDelete, "/v1/admin/cases/"+id, "admin-key", models.CaseTransitionRequest{UpdatedAt: validated.UpdatedAt}, nil)
+	if resp.status != http.StatusOK {
+		t.Fatalf("delete status = %d: %s", resp.status, resp.body)
+	}
+
+	// the cached detail is dropped by the write
+	resp = doRequest(t, server, http.MethodGet, "/v1/beneficiary-ownership/detail/"+id, "public-key", nil, nil)
+	if resp.status != http.StatusNotFound {
+		t.Fatalf("detail of the deleted case status = %d, want %d", resp.status, http.StatusNotFound)
+	}
+
+	resp = doRequest(t, server, http.MethodGet, "/v1/admin/cases/"+id, "admin-key", nil, nil)
+	if resp.status != http.StatusOK {
+		t.Fatalf("admin case status = %d: %s", resp.status, resp.body)
+	}
+
+	var deleted models.CaseModel
+	decodeData(t, resp, &deleted)
+
+	if deleted.Status != "deleted" {
+		t.Errorf("status = %q, want deleted", deleted.Status)
+	}
+}
+
+func TestChartStatuses(t *testing.T) {
+	server := newTestServer(t)
+
+	for _, test := range []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"draft", "status=draft", http.StatusForbidden},
+		{"validated and deleted", "status=validated,deleted", http.StatusForbidden},
+		{"unknown status", "status=archived", http.StatusBadRequest},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resp := doRequest(t, server, http.MethodGet, "/v1/beneficiary-ownership/chart?query=abc&"+test.query, "search-key", nil, nil)
+			if resp.status != test.want {
+				t.Fatalf("status = %d, want %d", resp.status, test.want)
+			}
+		})
+	}
+}
+
+func TestScreeningCost(t *testing.T) {
+	body := `{"inputs": [{"name": "PT ABC"}, {"name": "Budi"}, {"name": "CV XYZ"}]}`
+
+	r := httptest.NewRequest(http.MethodPost, "/screen", strings.NewReader(body))
+
+	if cost := screeningCost(r); cost != 3 {
+		t.Fatalf("cost = %d, want 3", cost)
+	}
+
+	// the handler reads the body that was counted
+	read, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(read) != body {
+		t.Fatalf("body = %q, want %q", read, body)
+	}
+}
+
+func TestCallerIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		apiKey   string
+		identity string
+		want     string
+	}{
+		{"registry client", "public-key", "someone-else", "public-client"},
+		{"shared key", "shared-key", "consumer", "api-key:consumer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+
+			handler := middlewares.ApiKey(testApiKeyStore{}, testSalt)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = callerIdentity(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-API-KEY", tt.apiKey)
+			req.Header.Set("X-REQUEST-IDENTITY", tt.identity)
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("callerIdentity = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
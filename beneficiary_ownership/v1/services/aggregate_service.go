@@ -0,0 +1,91 @@
+package bo_v1_services
+
+import (
+	"context"
+	"lexicon/bo-api/beneficiary_ownership"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// AggregateRefresher refreshes the aggregates the charts read, on a schedule
+// and when triggered after cases are written.
+type AggregateRefresher struct {
+	trigger chan struct{}
+	hooks   []func(ctx context.Context)
+}
+
+func NewAggregateRefresher() *AggregateRefresher {
+	return &AggregateRefresher{trigger: make(chan struct{}, 1)}
+}
+
+// OnRefresh registers a hook called after every refresh.
+func (a *AggregateRefresher) OnRefresh(hook func(ctx context.Context)) {
+	a.hooks = append(a.hooks, hook)
+}
+
+// Trigger asks Run for a refresh without waiting for it, the triggers that
+// come while one is pending make a single refresh.
+func (a *AggregateRefresher) Trigger() {
+	select {
+	case a.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Refresh refreshes the aggregates now.
+func (a *AggregateRefresher) Refresh(ctx context.Context) error {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	refreshedAt, err := models.RefreshAggregates(ctx, tx)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	log.Info().Msgf("Aggregates refreshed at %s", refreshedAt.Time.Format(time.RFC3339))
+
+	for _, hook := range a.hooks {
+		hook(ctx)
+	}
+
+	return nil
+}
+
+// Run refreshes the aggregates every interval and when triggered until the
+// context is cancelled, a zero interval only refreshes when triggered.
+func (a *AggregateRefresher) Run(ctx context.Context, interval time.Duration) {
+	var tick <-chan time.Time
+
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	log.Info().Msgf("Aggregate refresher started, running every %s", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Aggregate refresher stopped")
+			return
+		case <-tick:
+		case <-a.trigger:
+		}
+
+		if err := a.Refresh(ctx); err != nil {
+			log.Error().Err(err).Msg("Error refreshing aggregates")
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package bo_v1_services
+
+import (
+	"context"
+	"errors"
+	"lexicon/bo-api/beneficiary_ownership"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+	"lexicon/bo-api/common/utils"
+	"lexicon/bo-api/middlewares"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IssueApiClient registers a client under a new key, the key is returned
+// this once and only its hash is kept.
+func IssueApiClient(ctx context.Context, salt string, apiClientRequest models.ApiClientRequest) (models.IssuedApiClientModel, error) {
+	key, err := models.NewApiKey()
+	if err != nil {
+		return models.IssuedApiClientModel{}, err
+	}
+
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return models.IssuedApiClientModel{}, err
+	}
+
+	client, err := models.CreateApiClient(ctx, tx, apiClientRequest, key, utils.HashApiKey(salt, key))
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return models.IssuedApiClientModel{}, err
+	}
+
+	return models.IssuedApiClientModel{ApiClientModel: client, Key: models.ApiKeySecret(key)}, tx.Commit(ctx)
+}
+
+func GetApiClients(ctx context.Context) ([]models.ApiClientModel, error) {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	clients, err := models.GetApiClients(ctx, tx)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return clients, tx.Commit(ctx)
+}
+
+func GetApiClient(ctx context.Context, id string) (models.ApiClientModel, error) {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return models.ApiClientModel{}, err
+	}
+
+	client, err := models.GetApiClientById(ctx, tx, id)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return models.ApiClientModel{}, err
+	}
+
+	return client, tx.Commit(ctx)
+}
+
+// RevokeApiClient revokes a client. A server that resolved its key keeps
+// accepting it until the lookup expires, resolvedKeyTTL at most.
+func RevokeApiClient(ctx context.Context, id string) (models.ApiClientModel, error) {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return models.ApiClientModel{}, err
+	}
+
+	client, err := models.RevokeApiClient(ctx, tx, id)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return models.ApiClientModel{}, err
+	}
+
+	return client, tx.Commit(ctx)
+}
+
+const (
+	// resolvedKeyTTL is how long a key looked up in the registry, known or
+	// not, is resolved from memory.
+	resolvedKeyTTL = 30 * time.Second
+	// maxResolvedKeys bounds the lookups kept, unknown keys are cached too.
+	maxResolvedKeys = 10000
+)
+
+type resolvedKey struct {
+	caller    middlewares.ApiCaller
+	known     bool
+	expiresAt time.Time
+}
+
+// ApiKeyStore resolves keys against the api_clients registry. The keys set
+// in the config are resolved first as fixed clients, so consumers of the
+// shared keys keep working until they are moved to keys of their own. A
+// lookup in the registry is kept for resolvedKeyTTL.
+type ApiKeyStore struct {
+	fixed map[string]middlewares.ApiCaller
+
+	mu       sync.Mutex
+	resolved map[string]resolvedKey
+}
+
+func NewApiKeyStore() *ApiKeyStore {
+	return &ApiKeyStore{fixed: map[string]middlewares.ApiCaller{}, resolved: map[string]resolvedKey{}}
+}
+
+// AddFixedKey grants scopes to a key hash from the config, an empty hash is
+// ignored.
+func (s *ApiKeyStore) AddFixedKey(name string, hashedKey string, scopes ...string) {
+	if hashedKey == "" {
+		return
+	}
+
+	caller, ok := s.fixed[hashedKey]
+	if !ok {
+		caller = middlewares.ApiCaller{ClientID: name, Name: name, Shared: true}
+	}
+
+	for _, scope := range scopes {
+		if !caller.HasScope(scope) {
+			caller.Scopes = append(caller.Scopes, scope)
+		}
+	}
+
+	s.fixed[hashedKey] = caller
+}
+
+func (s *ApiKeyStore) ResolveApiKey(ctx context.Context, hashedKey string) (middlewares.ApiCaller, error) {
+	if caller, ok := s.fixed[hashedKey]; ok {
+		return caller, nil
+	}
+
+	if resolved, ok := s.cached(hashedKey); ok {
+		if !resolved.known {
+			return middlewares.ApiCaller{}, middlewares.ErrUnknownApiKey
+		}
+		return resolved.caller, nil
+	}
+
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return middlewares.ApiCaller{}, err
+	}
+
+	client, err := models.GetActiveApiClientByKeyHash(ctx, tx, hashedKey)
+
+	if err != nil {
+		tx.Rollback(ctx)
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			s.remember(hashedKey, resolvedKey{expiresAt: time.Now().Add(resolvedKeyTTL)})
+			return middlewares.ApiCaller{}, middlewares.ErrUnknownApiKey
+		}
+		return middlewares.ApiCaller{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return middlewares.ApiCaller{}, err
+	}
+
+	caller := middlewares.ApiCaller{ClientID: client.ID.String(), Name: client.Name, Scopes: client.Scopes}
+
+	// a key expiring sooner is not resolved past its expiry
+	expiresAt := time.Now().Add(resolvedKeyTTL)
+	if client.ExpiresAt.Valid && client.ExpiresAt.Time.Before(expiresAt) {
+		expiresAt = client.ExpiresAt.Time
+	}
+
+	s.remember(hashedKey, resolvedKey{caller: caller, known: true, expiresAt: expiresAt})
+
+	return caller, nil
+}
+
+func (s *ApiKeyStore) cached(hashedKey string) (resolvedKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resolved, ok := s.resolved[hashedKey]
+	if !ok || !time.Now().Before(resolved.expiresAt) {
+		return resolvedKey{}, false
+	}
+
+	return resolved, true
+}
+
+// remember keeps a lookup, making room by dropping the expired ones and, when
+// every one is still fresh, all of them.
+func (s *ApiKeyStore) remember(hashedKey string, resolved resolvedKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.resolved) >= maxResolvedKeys {
+		now := time.Now()
+		for key, kept := range s.resolved {
+			if !now.Before(kept.expiresAt) {
+				delete(s.resolved, key)
+			}
+		}
+
+		if len(s.resolved) >= maxResolvedKeys {
+			s.resolved = map[string]resolvedKey{}
+		}
+	}
+
+	s.resolved[hashedKey] = resolved
+}
+
+// RevokeApiClient revokes a client and forgets its key, so this server stops
+// accepting it at once.
+func (s *ApiKeyStore) RevokeApiClient(ctx context.Context, id string) (models.ApiClientModel, error) {
+	client, err := RevokeApiClient(ctx, id)
+	if err != nil {
+		return client, err
+	}
+
+	s.forgetClient(client.ID.String())
+
+	return client, nil
+}
+
+// forgetClient drops the cached lookups of a client.
+func (s *ApiKeyStore) forgetClient(clientID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, resolved := range s.resolved {
+		if resolved.known && resolved.caller.ClientID == clientID {
+			delete(s.resolved, key)
+		}
+	}
+}
@@ -2,45 +2,50 @@ package bo_v1_services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"lexicon/bo-api/beneficiary_ownership"
 	models "lexicon/bo-api/beneficiary_ownership/v1/models"
 	bo_v1_repositories "lexicon/bo-api/beneficiary_ownership/v1/repositories"
+	commonModels "lexicon/bo-api/common/models"
 	"os"
 
 	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
 )
 
-func GetDetail(ctx context.Context, id string) (models.DetailResultModel, error) {
-	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+// CaseChangeHook is called with the ids of the cases a write changed.
+type CaseChangeHook func(ctx context.Context, ids []string)
 
-	if err != nil {
-		return models.DetailResultModel{}, err
-	}
-
-	detail, err := models.GetDetailById(ctx, tx, id)
-
-	if err != nil {
-		return models.DetailResultModel{}, err
-	}
-
-	tx.Commit(ctx)
+// CaseService serves the cases of its repository, to the public endpoints
+// and to curators.
+type CaseService struct {
+	repo  bo_v1_repositories.CaseRepository
+	hooks []CaseChangeHook
+}
 
-	return detail, nil
+func NewCaseService(repo bo_v1_repositories.CaseRepository) *CaseService {
+	return &CaseService{repo: repo}
 }
 
-func GetUrlByCaseNumber(ctx context.Context, caseNumber []string) ([]string, error) {
-	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+// OnCaseChange registers a hook called after every write that changed cases.
+func (s *CaseService) OnCaseChange(hook CaseChangeHook) {
+	s.hooks = append(s.hooks, hook)
+}
 
-	if err != nil {
-		log.Err(err).Msg("Error starting transaction")
-		return nil, err
+func (s *CaseService) notify(ctx context.Context, ids ...string) {
+	for _, hook := range s.hooks {
+		hook(ctx, ids)
 	}
+}
+
+func (s *CaseService) GetDetail(ctx context.Context, id string) (models.DetailResultModel, error) {
+	return s.repo.GetDetail(ctx, id)
+}
 
-	id, err := bo_v1_repositories.GetIdsByCaseNumbers(ctx, tx, caseNumber)
+func (s *CaseService) GetUrlByCaseNumber(ctx context.Context, caseNumber []string) ([]string, error) {
+	id, err := s.repo.GetIdsByCaseNumbers(ctx, caseNumber)
 	if err != nil {
 		log.Err(err).Msg("Error getting ids by case numbers")
-		tx.Rollback(ctx)
 		return nil, err
 	}
 
@@ -54,7 +59,83 @@ func GetUrlByCaseNumber(ctx context.Context, caseNumber []string) ([]string, err
 		urls = append(urls, url)
 	}
 
-	tx.Commit(ctx)
-
 	return urls, nil
 }
+
+func (s *CaseService) GetCaseHistory(ctx context.Context, id string) ([]models.CaseRevisionModel, error) {
+	return s.repo.GetCaseHistory(ctx, id)
+}
+
+func (s *CaseService) GetCase(ctx context.Context, id string) (models.CaseModel, error) {
+	return s.repo.GetCase(ctx, id)
+}
+
+func (s *CaseService) GetCases(ctx context.Context, status string, page int64, perPage int64) (commonModels.BasePaginationResponse, error) {
+	return s.repo.GetCases(ctx, status, page, perPage)
+}
+
+func (s *CaseService) CreateCase(ctx context.Context, actor string, fields models.CaseFields) (models.CaseModel, error) {
+	written, err := s.repo.CreateCase(ctx, actor, fields)
+	if err == nil {
+		s.notify(ctx, written.ID.String())
+	}
+
+	return written, err
+}
+
+func (s *CaseService) UpdateCase(ctx context.Context, actor string, id string, caseRequest models.CaseRequest) (models.CaseModel, error) {
+	written, err := s.repo.UpdateCase(ctx, actor, id, caseRequest)
+	if err == nil {
+		s.notify(ctx, written.ID.String())
+	}
+
+	return written, err
+}
+
+func (s *CaseService) ValidateCase(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error) {
+	written, err := s.repo.ValidateCase(ctx, actor, id, updatedAt)
+	if err == nil {
+		s.notify(ctx, written.ID.String())
+	}
+
+	return written, err
+}
+
+func (s *CaseService) DeleteCase(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error) {
+	written, err := s.repo.DeleteCase(ctx, actor, id, updatedAt)
+	if err == nil {
+		s.notify(ctx, written.ID.String())
+	}
+
+	return written, err
+}
+
+func (s *CaseService) RestoreCase(ctx context.Context, actor string, id string, updatedAt null.Time) (models.CaseModel, error) {
+	written, err := s.repo.RestoreCase(ctx, actor, id, updatedAt)
+	if err == nil {
+		s.notify(ctx, written.ID.String())
+	}
+
+	return written, err
+}
+
+func (s *CaseService) ImportCases(ctx context.Context, actor string, records []json.RawMessage) (models.CaseImportReport, error) {
+	report, err := s.repo.ImportCases(ctx, actor, records)
+	if err != nil {
+		return report, err
+	}
+
+	var ids []string
+
+	for _, row := range report.Rows {
+		if row.Status == models.CaseImportCreated || row.Status == models.CaseImportUpdated {
+			ids = append(ids, row.ID)
+		}
+	}
+
+	if len(ids) > 0 {
+		s.notify(ctx, ids...)
+	}
+
+	return report, nil
+}
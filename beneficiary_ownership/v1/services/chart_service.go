@@ -6,14 +6,14 @@ import (
 	models "lexicon/bo-api/beneficiary_ownership/v1/models"
 )
 
-func GetChartData(ctx context.Context) (models.ChartsModel, error) {
+func GetChartData(ctx context.Context, searchRequest models.SearchRequest) (models.ChartsModel, error) {
 	tx, err := beneficiary_ownership.Pool.Begin(ctx)
 
 	if err != nil {
 		return models.ChartsModel{}, err
 	}
 
-	list, err := models.ChartData(ctx, tx)
+	list, err := models.ChartData(ctx, tx, searchRequest)
 
 	if err != nil {
 		return models.ChartsModel{}, err
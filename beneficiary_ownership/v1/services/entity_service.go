@@ -0,0 +1,26 @@
+package bo_v1_services
+
+import (
+	"context"
+	"lexicon/bo-api/beneficiary_ownership"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+)
+
+func GetEntity(ctx context.Context, id string) (models.EntityModel, error) {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return models.EntityModel{}, err
+	}
+
+	entity, err := models.GetEntityById(ctx, tx, id)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return models.EntityModel{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return entity, nil
+}
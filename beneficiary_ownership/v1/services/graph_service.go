@@ -0,0 +1,43 @@
+package bo_v1_services
+
+import (
+	"context"
+	"lexicon/bo-api/beneficiary_ownership"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+)
+
+func GetGraph(ctx context.Context, id string, hops int) (models.GraphModel, error) {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return models.GraphModel{}, err
+	}
+
+	graph, err := models.GetGraph(ctx, tx, id, hops)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return models.GraphModel{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return graph, nil
+}
+
+func RebuildGraph(ctx context.Context) (int, error) {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	synced, err := models.RebuildGraph(ctx, tx)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return 0, err
+	}
+
+	return synced, tx.Commit(ctx)
+}
@@ -6,16 +6,17 @@ import (
 	models "lexicon/bo-api/beneficiary_ownership/v1/models"
 )
 
-func GetLkppChartData(ctx context.Context) (models.LkppChartsModel, error) {
+func GetLkppChartData(ctx context.Context, lkppChartRequest models.LkppChartRequest) (models.LkppChartsModel, error) {
 	tx, err := beneficiary_ownership.Pool.Begin(ctx)
 
 	if err != nil {
 		return models.LkppChartsModel{}, err
 	}
 
-	list, err := models.LkppChartData(ctx, tx)
+	list, err := models.LkppChartData(ctx, tx, lkppChartRequest)
 
 	if err != nil {
+		tx.Rollback(ctx)
 		return models.LkppChartsModel{}, err
 	}
 
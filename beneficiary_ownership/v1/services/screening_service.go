@@ -0,0 +1,26 @@
+package bo_v1_services
+
+import (
+	"context"
+	"lexicon/bo-api/beneficiary_ownership"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+)
+
+func Screen(ctx context.Context, screeningRequest models.ScreeningRequest) ([]models.ScreeningResult, error) {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := models.ScreenNames(ctx, tx, screeningRequest)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	tx.Commit(ctx)
+
+	return results, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"lexicon/bo-api/beneficiary_ownership"
 	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+	"lexicon/bo-api/common/metrics"
 	baseModel "lexicon/bo-api/common/models"
 )
 
@@ -20,7 +21,44 @@ func Search(ctx context.Context, searchRequest models.SearchRequest) (baseModel.
 		return baseModel.BasePaginationResponse{}, err
 	}
 
+	if list.Data != nil && len(searchRequest.Facets) > 0 {
+		facets, err := models.SearchFacets(ctx, tx, searchRequest)
+
+		if err != nil {
+			tx.Rollback(ctx)
+			return baseModel.BasePaginationResponse{}, err
+		}
+
+		list.Facets = facets
+	}
+
 	tx.Commit(ctx)
 
+	results, _ := list.Data.([]models.SearchResultModel)
+	match := searchRequest.Match
+	if match == "" {
+		match = "exact"
+	}
+	metrics.SearchResults.WithLabelValues(match).Observe(float64(len(results)))
+
 	return list, nil // change to result of query
 }
+
+func ExportSearch(ctx context.Context, searchRequest models.SearchRequest, writer models.ExportWriter) error {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	err = models.ExportByRequest(ctx, tx, searchRequest, writer)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	tx.Commit(ctx)
+
+	return nil
+}
@@ -0,0 +1,294 @@
+package bo_v1_services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"lexicon/bo-api/beneficiary_ownership"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+	"lexicon/bo-api/common/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	deliveryBatchSize = 50
+	deliveryLogLimit  = 100
+	// longer than a batch takes to send, every webhook timing out included
+	deliveryLease = 10 * time.Minute
+)
+
+// CreateWatchlist stores a watchlist with a new signing secret, the secret is
+// returned this once.
+func CreateWatchlist(ctx context.Context, owner string, watchlistRequest models.WatchlistRequest) (models.SecretWatchlistModel, error) {
+	secret, err := models.NewWebhookSecret()
+	if err != nil {
+		return models.SecretWatchlistModel{}, err
+	}
+
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return models.SecretWatchlistModel{}, err
+	}
+
+	watchlist, err := models.CreateWatchlist(ctx, tx, owner, watchlistRequest, secret)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return models.SecretWatchlistModel{}, err
+	}
+
+	return models.SecretWatchlistModel{WatchlistModel: watchlist, SigningSecret: models.WebhookSecret(secret)}, tx.Commit(ctx)
+}
+
+// RotateWatchlistSecret gives a watchlist a new signing secret, returned this
+// once.
+func RotateWatchlistSecret(ctx context.Context, owner string, id string) (models.SecretWatchlistModel, error) {
+	secret, err := models.NewWebhookSecret()
+	if err != nil {
+		return models.SecretWatchlistModel{}, err
+	}
+
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return models.SecretWatchlistModel{}, err
+	}
+
+	watchlist, err := models.RotateWatchlistSecret(ctx, tx, owner, id, secret)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return models.SecretWatchlistModel{}, err
+	}
+
+	return models.SecretWatchlistModel{WatchlistModel: watchlist, SigningSecret: models.WebhookSecret(secret)}, tx.Commit(ctx)
+}
+
+func UpdateWatchlist(ctx context.Context, owner string, id string, watchlistRequest models.WatchlistRequest) (models.WatchlistModel, error) {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return models.WatchlistModel{}, err
+	}
+
+	watchlist, err := models.UpdateWatchlist(ctx, tx, owner, id, watchlistRequest)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return models.WatchlistModel{}, err
+	}
+
+	return watchlist, tx.Commit(ctx)
+}
+
+func DeleteWatchlist(ctx context.Context, owner string, id string) error {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	err = models.DeleteWatchlist(ctx, tx, owner, id)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func GetWatchlist(ctx context.Context, owner string, id string) (models.WatchlistModel, error) {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return models.WatchlistModel{}, err
+	}
+
+	watchlist, err := models.GetWatchlistById(ctx, tx, owner, id)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return models.WatchlistModel{}, err
+	}
+
+	tx.Commit(ctx)
+
+	return watchlist, nil
+}
+
+func GetWatchlists(ctx context.Context, owner string) ([]models.WatchlistModel, error) {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	watchlists, err := models.GetWatchlists(ctx, tx, owner)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	tx.Commit(ctx)
+
+	return watchlists, nil
+}
+
+func GetWatchlistDeliveries(ctx context.Context, owner string, id string) ([]models.WebhookDeliveryModel, error) {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := models.GetDeliveries(ctx, tx, owner, id, deliveryLogLimit)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	tx.Commit(ctx)
+
+	return deliveries, nil
+}
+
+// RunWatchlistWorker collects watchlist events and sends the due webhooks
+// every interval until the context is cancelled.
+func RunWatchlistWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Info().Msgf("Watchlist worker started, running every %s", interval)
+
+	for {
+		if err := collectWatchlistEvents(ctx); err != nil {
+			log.Error().Err(err).Msg("Error collecting watchlist events")
+		}
+
+		if err := sendDueWebhooks(ctx); err != nil {
+			log.Error().Err(err).Msg("Error sending webhooks")
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Watchlist worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func collectWatchlistEvents(ctx context.Context) error {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	queued, err := models.CollectWatchlistEvents(ctx, tx)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if queued > 0 {
+		log.Info().Msgf("Queued %d webhook deliveries", queued)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// sendDueWebhooks claims a batch of due deliveries and sends them outside of
+// the claiming transaction, each attempt is then recorded on its own.
+func sendDueWebhooks(ctx context.Context) error {
+	deliveries, err := claimDueDeliveries(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		statusCode, sendErr := sendWebhook(ctx, delivery)
+
+		if sendErr != nil {
+			log.Error().Err(sendErr).Msgf("Webhook delivery %s failed", delivery.ID)
+		}
+
+		if err = recordDeliveryAttempt(ctx, delivery, statusCode, sendErr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func claimDueDeliveries(ctx context.Context) ([]models.DueDelivery, error) {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := models.ClaimDueDeliveries(ctx, tx, deliveryBatchSize, deliveryLease)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return deliveries, tx.Commit(ctx)
+}
+
+func recordDeliveryAttempt(ctx context.Context, delivery models.DueDelivery, statusCode int, sendErr error) error {
+	tx, err := beneficiary_ownership.Pool.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	err = models.RecordDeliveryAttempt(ctx, tx, delivery, statusCode, sendErr)
+
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// sendWebhook posts the payload signed with the secret of the watchlist, the
+// receiver verifies X-REQUEST-SIGNATURE with utils.PayloadSignature.
+func sendWebhook(ctx context.Context, delivery models.DueDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.WebhookURL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	accessTime := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-WEBHOOK-ID", delivery.ID)
+	req.Header.Set("X-ACCESS-TIME", accessTime)
+	req.Header.Set("X-REQUEST-SIGNATURE", utils.PayloadSignature(delivery.SigningSecret, accessTime, delivery.Payload))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
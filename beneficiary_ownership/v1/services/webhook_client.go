@@ -0,0 +1,87 @@
+package bo_v1_services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var errWebhookAddress = errors.New("webhook_url must resolve to a public address")
+
+// carrier-grade NAT, private to the network of the provider
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicAddress reports whether a webhook may be sent to ip. Loopback,
+// private, link-local (the 169.254.169.254 metadata service included) and
+// multicast addresses are reachable from the server only, never a receiver.
+func isPublicAddress(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// ValidateWebhookURL checks that url is an http or https url whose host only
+// resolves to public addresses.
+func ValidateWebhookURL(ctx context.Context, rawURL string) error {
+	webhookURL, err := url.Parse(rawURL)
+	if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Hostname() == "" {
+		return errors.New("webhook_url must be an http or https url")
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, webhookURL.Hostname())
+	if err != nil {
+		return fmt.Errorf("webhook_url host can not be resolved: %s", webhookURL.Hostname())
+	}
+
+	for _, address := range addresses {
+		if !isPublicAddress(address.IP) {
+			return errWebhookAddress
+		}
+	}
+
+	return nil
+}
+
+// dialPublicOnly is the Control of the webhook dialer. The host is resolved
+// again when a webhook is sent, so it is the address actually dialed, after
+// any redirect, that is checked.
+func dialPublicOnly(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicAddress(ip) {
+		return errWebhookAddress
+	}
+
+	return nil
+}
+
+// webhookClient sends the webhooks directly, never through a proxy, so the
+// dialer sees the address of the receiver.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   dialPublicOnly,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	bo "lexicon/bo-api/beneficiary_ownership"
+	bo_v1 "lexicon/bo-api/beneficiary_ownership/v1"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+	bo_v1_services "lexicon/bo-api/beneficiary_ownership/v1/services"
+	"lexicon/bo-api/database"
+	"lexicon/bo-api/database/seeders"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v4"
+)
+
+// cacheWritingCommands change what the cached responses were built from.
+var cacheWritingCommands = map[string]bool{"graph-rebuild": true, "seed": true, "refresh-aggregates": true, "import": true}
+
+// runCommand runs a maintenance subcommand instead of serving the API.
+func runCommand(ctx context.Context, cfg config, cases *bo_v1_services.CaseService, aggregates *bo_v1_services.AggregateRefresher, responses *bo_v1.ResponseCache, args []string) error {
+	// a command only drops the responses of its own cache, the one of a
+	// running server is only shared through redis
+	if cacheWritingCommands[args[0]] && cfg.Cache.Store == "memory" {
+		log.Warn().Msg("CACHE_STORE is memory, running servers keep their cached responses until they expire")
+	}
+
+	switch args[0] {
+	case "graph-rebuild":
+		synced, err := bo_v1_services.RebuildGraph(ctx)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("Graph rebuilt from %d cases", synced)
+
+		// the entities of the cases are served with them
+		responses.InvalidateAll(ctx)
+		return nil
+	case "seed":
+		written, err := seeders.Seed(ctx, bo.Pool)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("Seeded %d cases", written)
+
+		// the entities and relations of the fixtures are part of the dataset
+		synced, err := bo_v1_services.RebuildGraph(ctx)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("Graph rebuilt from %d cases", synced)
+
+		// the seed writes around the case service, so nothing was dropped yet
+		responses.InvalidateAll(ctx)
+
+		// the counts of the charts are part of the dataset too
+		return aggregates.Refresh(ctx)
+	case "refresh-aggregates":
+		return aggregates.Refresh(ctx)
+	case "migrate":
+		return runMigrate(ctx, args[1:])
+	case "import":
+		return runImport(ctx, cases, aggregates, args[1:])
+	case "api-clients":
+		return runApiClients(ctx, cfg.ServerSalt, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// runMigrate runs "migrate [up]", "migrate down [steps]" or "migrate status".
+func runMigrate(ctx context.Context, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		applied, err := database.MigrateUp(ctx, bo.Pool)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("Applied %d migrations", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return errors.New("steps must be a positive number")
+			}
+			steps = n
+		}
+
+		reverted, err := database.MigrateDown(ctx, bo.Pool, steps)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("Reverted %d migrations", reverted)
+	case "status":
+		current, err := database.CurrentVersion(ctx, bo.Pool)
+		if err != nil {
+			return err
+		}
+
+		latest, err := database.LatestVersion()
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("Database is at version %d, latest migration is %d", current, latest)
+	default:
+		return fmt.Errorf("unknown migrate action %q, expected up, down or status", action)
+	}
+
+	return nil
+}
+
+// importActor is recorded as the author of the revisions of a CLI import.
+const importActor = "cli"
+
+// runImport runs "import <file> [csv|ndjson]", the format defaults to the
+// extension of the file. The aggregates are refreshed when cases changed, no
+// worker runs along the command to do it.
+func runImport(ctx context.Context, cases *bo_v1_services.CaseService, aggregates *bo_v1_services.AggregateRefresher, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: import <file> [csv|ndjson]")
+	}
+
+	format := ""
+	if len(args) > 1 {
+		format = args[1]
+	} else {
+		switch filepath.Ext(args[0]) {
+		case ".csv":
+			format = models.CaseImportCSV
+		case ".ndjson", ".jsonl":
+			format = models.CaseImportNDJSON
+		}
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	records, err := models.DecodeCaseRecords(file, format)
+	if err != nil {
+		return err
+	}
+
+	report, err := cases.ImportCases(ctx, importActor, records)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range report.Rows {
+		if row.Error != "" {
+			log.Warn().Msgf("Row %d %s: %s", row.Row, row.Status, row.Error)
+		}
+	}
+
+	log.Info().Msgf("Imported %s: %d created, %d updated, %d unchanged, %d skipped, %d invalid", args[0], report.Created, report.Updated, report.Unchanged, report.Skipped, report.Invalid)
+
+	if report.Created+report.Updated == 0 {
+		return nil
+	}
+
+	return aggregates.Refresh(ctx)
+}
+
+// runApiClients runs "api-clients list", "api-clients issue <name> <scope,...>
+// [expires YYYY-MM-DD]" or "api-clients revoke <id>". The key of an issued
+// client is printed on stdout, it can not be read back later.
+func runApiClients(ctx context.Context, salt string, args []string) error {
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "list":
+		clients, err := bo_v1_services.GetApiClients(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range clients {
+			expires := "never"
+			if c.ExpiresAt.Valid {
+				expires = c.ExpiresAt.Time.Format(time.DateOnly)
+			}
+			log.Info().Msgf("%s %s (%s...) scopes %s, expires %s, revoked %t", c.ID, c.Name, c.KeyPrefix, strings.Join(c.Scopes, ","), expires, c.Revoked)
+		}
+	case "issue":
+		if len(args) < 3 {
+			return errors.New("usage: api-clients issue <name> <scope,...> [expires YYYY-MM-DD]")
+		}
+
+		req := models.ApiClientRequest{Name: args[1], Scopes: strings.Split(args[2], ",")}
+
+		if len(args) > 3 {
+			expires, err := time.Parse(time.DateOnly, args[3])
+			if err != nil {
+				return errors.New("expires must be a date in the format of YYYY-MM-DD")
+			}
+			req.ExpiresAt = null.TimeFrom(expires)
+		}
+
+		if err := req.Validate(); err != nil {
+			return err
+		}
+
+		if salt == "" {
+			return errors.New("SALT is required to issue keys")
+		}
+
+		issued, err := bo_v1_services.IssueApiClient(ctx, salt, req)
+		if err != nil {
+			return err
+		}
+
+		log.Info().Msgf("Issued api client %s %s with scopes %s, its key follows and is not shown again", issued.ID, issued.Name, strings.Join(issued.Scopes, ","))
+		fmt.Println(string(issued.Key))
+	case "revoke":
+		if len(args) < 2 {
+			return errors.New("usage: api-clients revoke <id>")
+		}
+
+		revoked, err := bo_v1_services.RevokeApiClient(ctx, args[1])
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("api client %s not found", args[1])
+		}
+		if err != nil {
+			return err
+		}
+
+		log.Info().Msgf("Revoked api client %s %s", revoked.ID, revoked.Name)
+	default:
+		return fmt.Errorf("unknown api-clients action %q, expected list, issue or revoke", action)
+	}
+
+	return nil
+}
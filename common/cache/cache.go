@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Store keeps cached values by key.
+type Store interface {
+	// Get returns the value of key and whether it was found, an expired
+	// value is not.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// Incr increments the counter of key and returns it, counters do not
+	// expire and are not evicted.
+	Incr(ctx context.Context, key string) (int64, error)
+	// Counter returns the counter of key, 0 when it was never incremented.
+	Counter(ctx context.Context, key string) (int64, error)
+}
+
+// Cache keeps values in namespaces. A namespace is invalidated as a whole by
+// moving it to a new generation, the values of the old one are never read
+// again and age out of the store.
+type Cache struct {
+	store Store
+}
+
+func New(store Store) *Cache {
+	return &Cache{store: store}
+}
+
+func (c *Cache) key(ctx context.Context, namespace string, key string) (string, error) {
+	generation, err := c.store.Counter(ctx, "generation:"+namespace)
+	if err != nil {
+		return "", err
+	}
+
+	return namespace + ":" + strconv.FormatInt(generation, 10) + ":" + key, nil
+}
+
+// Fetch returns the value of key in namespace, or loads it and keeps it for
+// ttl. A failing store is logged and the value loaded, a failing load is
+// returned and not kept.
+func (c *Cache) Fetch(ctx context.Context, namespace string, key string, ttl time.Duration, load func() ([]byte, error)) ([]byte, error) {
+	storeKey, err := c.key(ctx, namespace, key)
+	if err != nil {
+		log.Error().Err(err).Str("namespace", namespace).Msg("Error reading cache generation")
+		return load()
+	}
+
+	value, ok, err := c.store.Get(ctx, storeKey)
+	if err != nil {
+		log.Error().Err(err).Str("namespace", namespace).Msg("Error reading cache")
+	}
+
+	if ok {
+		return value, nil
+	}
+
+	value, err = load()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.store.Set(ctx, storeKey, value, ttl); err != nil {
+		log.Error().Err(err).Str("namespace", namespace).Msg("Error writing cache")
+	}
+
+	return value, nil
+}
+
+// Forget drops the value of key in namespace.
+func (c *Cache) Forget(ctx context.Context, namespace string, key string) error {
+	storeKey, err := c.key(ctx, namespace, key)
+	if err != nil {
+		return err
+	}
+
+	return c.store.Delete(ctx, storeKey)
+}
+
+// Invalidate drops every value of the namespaces.
+func (c *Cache) Invalidate(ctx context.Context, namespaces ...string) error {
+	for _, namespace := range namespaces {
+		if _, err := c.store.Incr(ctx, "generation:"+namespace); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "bo_api"
+
+var (
+	// HttpRequests counts the requests served, by chi route pattern.
+	HttpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests served, by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HttpRequestDuration is the latency of the requests served.
+	HttpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of the requests served, by method and route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// ChatbotRequestDuration is the latency of the chatbot upstream, failed
+	// requests included.
+	ChatbotRequestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "chatbot_request_duration_seconds",
+		Help:      "Latency of the requests sent to the chatbot upstream.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	})
+
+	// ChatbotErrors counts the chatbot requests that failed or were answered
+	// with a server error.
+	ChatbotErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chatbot_errors_total",
+		Help:      "Requests to the chatbot upstream that failed or got a 5xx answer.",
+	})
+
+	// SearchResults is the number of results a search returns, by match mode.
+	SearchResults = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "search_results",
+		Help:      "Results returned by a search page, by match mode.",
+		Buckets:   []float64{0, 1, 5, 10, 20, 50, 100},
+	}, []string{"match"})
+
+	// RateLimited counts the requests refused by the rate limiter, by route
+	// group and by whether the burst or the daily quota ran out.
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests refused by the rate limiter, by route group and limit.",
+	}, []string{"group", "limit"})
+)
+
+// Collectors are the metrics of the API, they are registered by the server.
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{HttpRequests, HttpRequestDuration, ChatbotRequestDuration, ChatbotErrors, SearchResults, RateLimited}
+}
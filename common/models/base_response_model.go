@@ -1,8 +1,9 @@
 package models
 
 type BasePaginationResponse struct {
-	Data interface{}  `json:"data"`
-	Meta MetaResponse `json:"meta"`
+	Data   interface{}  `json:"data"`
+	Meta   MetaResponse `json:"meta"`
+	Facets interface{}  `json:"facets,omitempty"`
 }
 
 type BaseResponse struct {
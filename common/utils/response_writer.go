@@ -1,9 +1,12 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	baseResponse "lexicon/bo-api/common/models"
 	"net/http"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 )
@@ -54,3 +57,26 @@ func WriteError(w http.ResponseWriter, status int, err error) {
 
 	json.NewEncoder(w).Encode(j)
 }
+
+// WriteETag writes a JSON body that is already encoded with an ETag of its
+// content, or only 304 Not Modified when the request has it in If-None-Match.
+func WriteETag(w http.ResponseWriter, r *http.Request, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Add("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// HashApiKey is how an api key is stored, sha256 of the salt and the key.
+func HashApiKey(salt string, apiKey string) string {
+	hash := sha256.New()
+	hash.Write([]byte(salt + apiKey))
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// RequestSignature is the signature clients send in X-REQUEST-SIGNATURE,
+// sha256 of the salt, the access time and the api key.
+func RequestSignature(salt string, accessTime string, apiKey string) string {
+	hash := sha256.New()
+	hash.Write([]byte(salt + accessTime + apiKey))
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// PayloadSignature signs an outgoing payload and its access time as an
+// HMAC-SHA256 keyed on a secret shared with the receiver, so the receiver can
+// verify the body was not altered.
+func PayloadSignature(secret string, accessTime string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(accessTime))
+	mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CanonicalQuery encodes a query with its keys and the values of each key
+// sorted, so the order the client sent them in does not change a signature.
+func CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var parts []string
+
+	for _, key := range keys {
+		values := slices.Clone(query[key])
+		slices.Sort(values)
+
+		for _, value := range values {
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// RequestSignatureV2 is the signature of the v2 scheme, an HMAC-SHA256 keyed
+// on HashApiKey of the client key over the method, the escaped path, the
+// canonical query, the hex sha256 of the body, the access time and the
+// nonce, each on its own line.
+func RequestSignatureV2(salt string, apiKey string, method string, path string, query url.Values, body []byte, accessTime string, nonce string) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(HashApiKey(salt, apiKey)))
+	mac.Write([]byte(strings.Join([]string{
+		"v2",
+		method,
+		path,
+		CanonicalQuery(query),
+		hex.EncodeToString(bodyHash[:]),
+		accessTime,
+		nonce,
+	}, "\n")))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	bo_v1 "lexicon/bo-api/beneficiary_ownership/v1"
+	"lexicon/bo-api/middlewares"
 	"os"
 	"strconv"
+	"time"
 )
 
 func loadEnvString(key string, result *string) {
@@ -15,6 +18,19 @@ func loadEnvString(key string, result *string) {
 	*result = s
 }
 
+func loadEnvBool(key string, result *bool) {
+	s, ok := os.LookupEnv(key)
+
+	if !ok {
+		return
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return
+	}
+	*result = b
+}
+
 func loadEnvUint(key string, result *uint) {
 	s, ok := os.LookupEnv(key)
 
@@ -87,34 +103,199 @@ func (l *listenConfig) loadFromEnv() {
 	loadEnvUint("APP_LISTEN_PORT", &l.Port)
 }
 
+// defaultMetricsListenConfig keeps the metrics on the loopback, away from
+// the port of the API.
+func defaultMetricsListenConfig() listenConfig {
+	return listenConfig{
+		Host: "127.0.0.1",
+		Port: 9090,
+	}
+}
+
+/* Redis Configuration */
+
+type redisConfig struct {
+	Host     string `json:"host"`
+	Port     uint   `json:"port"`
+	Password string `json:"password"`
+}
+
+func (r redisConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", r.Host, r.Port)
+}
+
+func defaultRedis() redisConfig {
+	return redisConfig{
+		Host:     "",
+		Port:     6379,
+		Password: "",
+	}
+}
+
+func (r *redisConfig) loadFromEnv() {
+	loadEnvString("REDIS_HOST", &r.Host)
+	loadEnvUint("REDIS_PORT", &r.Port)
+	loadEnvString("REDIS_PASSWORD", &r.Password)
+}
+
+/* Rate Limit Configuration */
+
+type rateLimitConfig struct {
+	PerMinute uint `json:"per_minute"`
+	Burst     uint `json:"burst"`
+	Daily     uint `json:"daily"`
+}
+
+func (l rateLimitConfig) RateLimit() middlewares.RateLimit {
+	return middlewares.RateLimit{
+		Rate:       float64(l.PerMinute) / 60,
+		Burst:      int(l.Burst),
+		DailyQuota: int(l.Daily),
+	}
+}
+
+func (l *rateLimitConfig) loadFromEnv(prefix string) {
+	loadEnvUint(prefix+"_PER_MINUTE", &l.PerMinute)
+	loadEnvUint(prefix+"_BURST", &l.Burst)
+	loadEnvUint(prefix+"_DAILY", &l.Daily)
+}
+
+type rateLimitsConfig struct {
+	// Store is where the limits are counted, memory or redis.
+	Store   string          `json:"store"`
+	Search  rateLimitConfig `json:"search"`
+	Export  rateLimitConfig `json:"export"`
+	Chatbot rateLimitConfig `json:"chatbot"`
+	// Screening counts the names screened, not the requests.
+	Screening rateLimitConfig `json:"screening"`
+}
+
+func defaultRateLimits() rateLimitsConfig {
+	return rateLimitsConfig{
+		Store:     "memory",
+		Search:    rateLimitConfig{PerMinute: 60, Burst: 30, Daily: 10000},
+		Export:    rateLimitConfig{PerMinute: 6, Burst: 2, Daily: 200},
+		Chatbot:   rateLimitConfig{PerMinute: 20, Burst: 10, Daily: 1000},
+		Screening: rateLimitConfig{PerMinute: 1000, Burst: 500, Daily: 50000},
+	}
+}
+
+func (l *rateLimitsConfig) loadFromEnv() {
+	loadEnvString("RATE_LIMIT_STORE", &l.Store)
+	l.Search.loadFromEnv("RATE_LIMIT_SEARCH")
+	l.Export.loadFromEnv("RATE_LIMIT_EXPORT")
+	l.Chatbot.loadFromEnv("RATE_LIMIT_CHATBOT")
+	l.Screening.loadFromEnv("RATE_LIMIT_SCREENING")
+}
+
+// Limits are the limits of each route group.
+func (l rateLimitsConfig) Limits() map[string]middlewares.RateLimit {
+	return map[string]middlewares.RateLimit{
+		middlewares.RateLimitSearch:    l.Search.RateLimit(),
+		middlewares.RateLimitExport:    l.Export.RateLimit(),
+		middlewares.RateLimitChatbot:   l.Chatbot.RateLimit(),
+		middlewares.RateLimitScreening: l.Screening.RateLimit(),
+	}
+}
+
+/* Cache Configuration */
+
+type cacheConfig struct {
+	// Store is where responses are cached, memory or redis.
+	Store string `json:"store"`
+	// Size is the number of responses the memory store keeps.
+	Size uint `json:"size"`
+	// seconds each kind of response is cached, 0 to not cache it
+	ChartTTL  uint `json:"chart_ttl"`
+	DetailTTL uint `json:"detail_ttl"`
+	SearchTTL uint `json:"search_ttl"`
+}
+
+func defaultCache() cacheConfig {
+	return cacheConfig{
+		Store:     "memory",
+		Size:      1000,
+		ChartTTL:  300,
+		DetailTTL: 300,
+		SearchTTL: 60,
+	}
+}
+
+func (c *cacheConfig) loadFromEnv() {
+	loadEnvString("CACHE_STORE", &c.Store)
+	loadEnvUint("CACHE_SIZE", &c.Size)
+	loadEnvUint("CACHE_CHART_TTL", &c.ChartTTL)
+	loadEnvUint("CACHE_DETAIL_TTL", &c.DetailTTL)
+	loadEnvUint("CACHE_SEARCH_TTL", &c.SearchTTL)
+}
+
+func (c cacheConfig) TTLs() bo_v1.CacheTTLs {
+	return bo_v1.CacheTTLs{
+		Chart:  time.Duration(c.ChartTTL) * time.Second,
+		Detail: time.Duration(c.DetailTTL) * time.Second,
+		Search: time.Duration(c.SearchTTL) * time.Second,
+	}
+}
+
 type config struct {
-	Listen             listenConfig `json:"listen"`
-	PgSql              pgSqlConfig  `json:"pgsql"`
-	BackendApiKey      string       `json:"api_key"`
-	ServerSalt         string       `json:"salt"`
-	ChatbotBaseURL     string       `json:"chatbot_base_url"`
-	BaseURL            string       `json:"base_url"`
-	CorsAllowedOrigins string       `json:"cors_allowed_origins"`
+	Listen             listenConfig     `json:"listen"`
+	MetricsListen      listenConfig     `json:"metrics_listen"`
+	PgSql              pgSqlConfig      `json:"pgsql"`
+	Redis              redisConfig      `json:"redis"`
+	RateLimits         rateLimitsConfig `json:"rate_limits"`
+	Cache              cacheConfig      `json:"cache"`
+	BackendApiKey      string           `json:"api_key"`
+	AdminApiKey        string           `json:"admin_api_key"`
+	ServerSalt         string           `json:"salt"`
+	ChatbotBaseURL     string           `json:"chatbot_base_url"`
+	BaseURL            string           `json:"base_url"`
+	CorsAllowedOrigins string           `json:"cors_allowed_origins"`
+	WatchlistInterval  uint             `json:"watchlist_interval"`
+	ShutdownTimeout    uint             `json:"shutdown_timeout"`
+	AggregateInterval  uint             `json:"aggregate_interval"`
+	SignatureMaxSkew   uint             `json:"signature_max_skew"`
+	SignatureRequireV2 bool             `json:"signature_require_v2"`
 }
 
 func (c *config) loadFromEnv() {
 	c.Listen.loadFromEnv()
+	loadEnvString("METRICS_LISTEN_HOST", &c.MetricsListen.Host)
+	loadEnvUint("METRICS_LISTEN_PORT", &c.MetricsListen.Port)
 	c.PgSql.loadFromEnv()
+	c.Redis.loadFromEnv()
+	c.RateLimits.loadFromEnv()
+	c.Cache.loadFromEnv()
 	loadEnvString("API_KEY", &c.BackendApiKey)
+	loadEnvString("ADMIN_API_KEY", &c.AdminApiKey)
 	loadEnvString("SALT", &c.ServerSalt)
 	loadEnvString("CHATBOT_BASE_URL", &c.ChatbotBaseURL)
 	loadEnvString("BASE_URL", &c.BaseURL)
 	loadEnvString("CORS_ALLOWED_ORIGINS", &c.CorsAllowedOrigins)
+	loadEnvUint("WATCHLIST_INTERVAL", &c.WatchlistInterval)
+	loadEnvUint("SHUTDOWN_TIMEOUT", &c.ShutdownTimeout)
+	loadEnvUint("AGGREGATE_REFRESH_INTERVAL", &c.AggregateInterval)
+	loadEnvUint("SIGNATURE_MAX_SKEW", &c.SignatureMaxSkew)
+	loadEnvBool("SIGNATURE_REQUIRE_V2", &c.SignatureRequireV2)
 }
 
 func defaultConfig() config {
 	return config{
 		Listen:             defaultListenConfig(),
+		MetricsListen:      defaultMetricsListenConfig(),
 		PgSql:              defaultPgSql(),
+		Redis:              defaultRedis(),
+		RateLimits:         defaultRateLimits(),
+		Cache:              defaultCache(),
 		BackendApiKey:      "", //
+		AdminApiKey:        "", //
 		ServerSalt:         "", //
 		ChatbotBaseURL:     "",
 		BaseURL:            "",
 		CorsAllowedOrigins: "",
+		WatchlistInterval:  60,
+		ShutdownTimeout:    30,
+		AggregateInterval:  600,
+		SignatureMaxSkew:   300,
+		SignatureRequireV2: false,
 	}
 }
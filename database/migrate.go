@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Schema is the schema the API reads from, it has to match the search_path
+// of the connection string.
+const Schema = "bo_v1"
+
+// migrationLockID keys the advisory lock held while migrating, so two
+// instances starting together do not run the same migration.
+const migrationLockID = 7130142
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var ErrSchemaMismatch = errors.New("database schema does not match this build")
+
+// Migration is a versioned pair of up and down SQL scripts.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations returns the embedded migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+
+		script, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// LatestVersion is the version of the last embedded migration.
+func LatestVersion() (int, error) {
+	migrations, err := Migrations()
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// CurrentVersion is the version of the last migration applied to the
+// database, 0 when none has been.
+func CurrentVersion(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+	var exists bool
+
+	err := pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, Schema+".schema_migrations").Scan(&exists)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int
+	err = pool.QueryRow(ctx, `SELECT COALESCE(max(version), 0) FROM `+Schema+`.schema_migrations`).Scan(&version)
+
+	return version, err
+}
+
+// CheckSchema fails unless the database is migrated to exactly the latest
+// embedded migration.
+func CheckSchema(ctx context.Context, pool *pgxpool.Pool) error {
+	latest, err := LatestVersion()
+	if err != nil {
+		return err
+	}
+
+	current, err := CurrentVersion(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	if current != latest {
+		return fmt.Errorf("%w: database is at version %d, build expects %d, run the migrate command", ErrSchemaMismatch, current, latest)
+	}
+
+	return nil
+}
+
+// MigrateUp applies every pending migration, each in its own transaction,
+// and returns how many were applied.
+func MigrateUp(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+
+	err = withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		current, err := CurrentVersion(ctx, pool)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if migration.Version <= current {
+				continue
+			}
+
+			log.Info().Msgf("Applying migration %d_%s", migration.Version, migration.Name)
+
+			err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, migration.Up); err != nil {
+					return err
+				}
+
+				_, err := tx.Exec(ctx, `INSERT INTO `+Schema+`.schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// MigrateDown reverts the last steps applied migrations and returns how many
+// were reverted.
+func MigrateDown(ctx context.Context, pool *pgxpool.Pool, steps int) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+
+	err = withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		for ; reverted < steps; reverted++ {
+			current, err := CurrentVersion(ctx, pool)
+			if err != nil || current == 0 {
+				return err
+			}
+
+			index := sort.Search(len(migrations), func(i int) bool {
+				return migrations[i].Version >= current
+			})
+			if index == len(migrations) || migrations[index].Version != current {
+				return fmt.Errorf("migration %d is applied but not part of this build", current)
+			}
+
+			migration := migrations[index]
+
+			log.Info().Msgf("Reverting migration %d_%s", migration.Version, migration.Name)
+
+			err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, migration.Down); err != nil {
+					return err
+				}
+
+				_, err := tx.Exec(ctx, `DELETE FROM `+Schema+`.schema_migrations WHERE version = $1`, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// withMigrationLock creates the schema and the migrations table when missing
+// and runs fn on a connection holding the migration lock.
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return err
+	}
+
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	_, err = conn.Exec(ctx, `
+	CREATE SCHEMA IF NOT EXISTS `+Schema+`;
+	CREATE TABLE IF NOT EXISTS `+Schema+`.schema_migrations (
+		version    integer PRIMARY KEY,
+		name       text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
@@ -0,0 +1,39 @@
+-- The baseline schema. Objects are only created when missing so databases set
+-- up by hand before migrations existed can adopt it.
+CREATE TABLE IF NOT EXISTS cases (
+    id                    text PRIMARY KEY,
+    subject               text NOT NULL,
+    subject_type          integer NOT NULL,
+    person_in_charge      text,
+    benificiary_ownership text,
+    case_date             date,
+    decision_number       text,
+    source                text NOT NULL DEFAULT '',
+    link                  text NOT NULL DEFAULT '',
+    nation                text NOT NULL DEFAULT '',
+    punishment_start      date,
+    punishment_end        date,
+    case_type             integer NOT NULL,
+    year                  text NOT NULL DEFAULT '',
+    summary               text NOT NULL DEFAULT '',
+    -- 0 deleted, 1 validated, 2 draft
+    status                integer NOT NULL DEFAULT 2,
+    extra_data            jsonb,
+    fulltext_search_index tsvector GENERATED ALWAYS AS (
+        to_tsvector('english',
+            subject || ' ' ||
+            COALESCE(person_in_charge, '') || ' ' ||
+            COALESCE(benificiary_ownership, '') || ' ' ||
+            COALESCE(decision_number, '') || ' ' ||
+            summary)
+    ) STORED,
+    created_at            timestamptz NOT NULL DEFAULT now(),
+    updated_at            timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS cases_fulltext_search_index_idx ON cases USING gin (fulltext_search_index);
+CREATE INDEX IF NOT EXISTS cases_status_case_date_idx ON cases (status, case_date);
+CREATE INDEX IF NOT EXISTS cases_status_year_idx ON cases (status, year);
+CREATE INDEX IF NOT EXISTS cases_updated_at_id_idx ON cases (updated_at, id);
+CREATE INDEX IF NOT EXISTS cases_decision_number_idx ON cases (decision_number);
+CREATE INDEX IF NOT EXISTS cases_extra_data_type_idx ON cases ((extra_data -> 0 ->> 'type'));
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS entity_relations;
+DROP TABLE IF EXISTS entity_aliases;
+DROP TABLE IF EXISTS entities;
@@ -0,0 +1,36 @@
+CREATE TABLE entities (
+    id              text PRIMARY KEY,
+    entity_type     integer NOT NULL,
+    name            text NOT NULL,
+    normalized_name text NOT NULL,
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    updated_at      timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (entity_type, normalized_name)
+);
+
+CREATE TABLE entity_aliases (
+    entity_id        text NOT NULL REFERENCES entities (id) ON DELETE CASCADE,
+    entity_type      integer NOT NULL,
+    alias            text NOT NULL,
+    normalized_alias text NOT NULL,
+    confidence       double precision NOT NULL,
+    UNIQUE (entity_type, normalized_alias)
+);
+
+CREATE INDEX entity_aliases_entity_id_idx ON entity_aliases (entity_id);
+
+CREATE TABLE entity_relations (
+    id               text PRIMARY KEY,
+    case_id          text NOT NULL REFERENCES cases (id) ON DELETE CASCADE,
+    source_entity_id text NOT NULL REFERENCES entities (id) ON DELETE CASCADE,
+    -- empty for subject_of, which points to the case itself
+    target_entity_id text REFERENCES entities (id) ON DELETE CASCADE,
+    role             integer NOT NULL,
+    percentage       double precision,
+    confidence       double precision NOT NULL,
+    created_at       timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX entity_relations_case_id_idx ON entity_relations (case_id, role);
+CREATE INDEX entity_relations_source_entity_id_idx ON entity_relations (source_entity_id);
+CREATE INDEX entity_relations_target_entity_id_idx ON entity_relations (target_entity_id);
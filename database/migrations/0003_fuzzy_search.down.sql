@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS cases_person_in_charge_trgm_idx;
+DROP INDEX IF EXISTS cases_benificiary_ownership_trgm_idx;
+DROP INDEX IF EXISTS cases_subject_trgm_idx;
+DROP FUNCTION IF EXISTS immutable_unaccent(text);
@@ -0,0 +1,40 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm WITH SCHEMA bo_v1;
+CREATE EXTENSION IF NOT EXISTS unaccent WITH SCHEMA bo_v1;
+
+-- an extension already installed in another schema is left there by IF NOT
+-- EXISTS, where the search_path of the API does not find it
+DO $$
+DECLARE
+    misplaced record;
+BEGIN
+    FOR misplaced IN
+        SELECT e.extname, n.nspname
+        FROM pg_extension e
+        JOIN pg_namespace n ON n.oid = e.extnamespace
+        WHERE e.extname IN ('pg_trgm', 'unaccent')
+        AND n.nspname <> 'bo_v1'
+    LOOP
+        RAISE EXCEPTION 'extension % is installed in schema %, not bo_v1, move it with ALTER EXTENSION % SET SCHEMA bo_v1',
+            misplaced.extname, misplaced.nspname, misplaced.extname;
+    END LOOP;
+END
+$$;
+
+-- unaccent is only stable because its dictionary can change, pinning the
+-- dictionary makes it safe to use in an index
+CREATE FUNCTION immutable_unaccent(text) RETURNS text
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT
+    AS $$ SELECT bo_v1.unaccent('bo_v1.unaccent'::regdictionary, $1) $$;
+
+-- the expressions must match foldNameSQL in search_fuzzy.go
+CREATE INDEX cases_subject_trgm_idx ON cases USING gin (
+    (replace(replace(replace(replace(replace(replace(lower(immutable_unaccent(subject)), 'oe', 'u'), 'dj', 'j'), 'tj', 'c'), 'ch', 'h'), 'kh', 'h'), 'y', 'j')) gin_trgm_ops
+);
+
+CREATE INDEX cases_benificiary_ownership_trgm_idx ON cases USING gin (
+    (replace(replace(replace(replace(replace(replace(lower(immutable_unaccent(COALESCE(benificiary_ownership, ''))), 'oe', 'u'), 'dj', 'j'), 'tj', 'c'), 'ch', 'h'), 'kh', 'h'), 'y', 'j')) gin_trgm_ops
+);
+
+CREATE INDEX cases_person_in_charge_trgm_idx ON cases USING gin (
+    (replace(replace(replace(replace(replace(replace(lower(immutable_unaccent(COALESCE(person_in_charge, ''))), 'oe', 'u'), 'dj', 'j'), 'tj', 'c'), 'ch', 'h'), 'kh', 'h'), 'y', 'j')) gin_trgm_ops
+);
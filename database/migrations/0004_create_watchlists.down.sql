@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS watchlist_case_snapshots;
+DROP TABLE IF EXISTS watchlist_worker_state;
+DROP TABLE IF EXISTS watchlist_items;
+DROP TABLE IF EXISTS watchlists;
@@ -0,0 +1,52 @@
+CREATE TABLE watchlists (
+    id          text PRIMARY KEY,
+    owner       text NOT NULL,
+    name        text NOT NULL,
+    webhook_url text NOT NULL,
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    updated_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX watchlists_owner_idx ON watchlists (owner, created_at DESC);
+
+CREATE TABLE watchlist_items (
+    watchlist_id text NOT NULL REFERENCES watchlists (id) ON DELETE CASCADE,
+    -- 1 subject, 2 entity
+    kind         integer NOT NULL,
+    value        text NOT NULL,
+    label        text NOT NULL,
+    PRIMARY KEY (watchlist_id, kind, value)
+);
+
+-- a single row holding how far the worker has read the cases
+CREATE TABLE watchlist_worker_state (
+    id              integer PRIMARY KEY CHECK (id = 1),
+    last_updated_at timestamptz NOT NULL,
+    last_case_id    text NOT NULL
+);
+
+CREATE TABLE watchlist_case_snapshots (
+    case_id          text PRIMARY KEY,
+    status           integer NOT NULL,
+    punishment_start date,
+    punishment_end   date
+);
+
+CREATE TABLE webhook_deliveries (
+    id               text PRIMARY KEY,
+    watchlist_id     text NOT NULL REFERENCES watchlists (id) ON DELETE CASCADE,
+    event            text NOT NULL,
+    case_id          text NOT NULL,
+    payload          jsonb NOT NULL,
+    -- 1 pending, 2 delivered, 3 failed
+    status           integer NOT NULL,
+    attempts         integer NOT NULL DEFAULT 0,
+    last_status_code integer,
+    last_error       text,
+    next_attempt_at  timestamptz,
+    delivered_at     timestamptz,
+    created_at       timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 1;
+CREATE INDEX webhook_deliveries_watchlist_id_idx ON webhook_deliveries (watchlist_id, created_at DESC);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS case_revisions;
+DROP FUNCTION IF EXISTS case_revisions_append_only();
@@ -0,0 +1,23 @@
+CREATE TABLE case_revisions (
+    id         text PRIMARY KEY,
+    case_id    text NOT NULL REFERENCES cases (id),
+    actor      text NOT NULL,
+    action     text NOT NULL,
+    changes    jsonb NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX case_revisions_case_id_idx ON case_revisions (case_id, created_at);
+
+-- the audit trail is append only
+CREATE FUNCTION case_revisions_append_only() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    RAISE EXCEPTION 'case_revisions is append only';
+END;
+$$;
+
+CREATE TRIGGER case_revisions_append_only
+    BEFORE UPDATE OR DELETE ON case_revisions
+    FOR EACH ROW EXECUTE FUNCTION case_revisions_append_only();
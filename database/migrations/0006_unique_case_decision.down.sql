@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS cases_decision_number_idx ON cases (decision_number);
+DROP INDEX IF EXISTS cases_decision_number_source_key;
@@ -0,0 +1,30 @@
+-- imports upsert on the decision and the source that published it. Cases
+-- without a decision_number are never equal under the index, imports require
+-- one, so those cases are never upserted and only change through the admin.
+--
+-- a database adopted with the same decision stored twice can not be given the
+-- index, the duplicates are reported to be merged or deleted first
+DO $$
+DECLARE
+    duplicates text;
+BEGIN
+    SELECT string_agg(format('%s from %s (%s)', decision_number, source, ids), '; ' ORDER BY decision_number, source)
+    INTO duplicates
+    FROM (
+        SELECT decision_number, source, string_agg(id, ', ' ORDER BY id) AS ids
+        FROM cases
+        WHERE decision_number IS NOT NULL
+        GROUP BY decision_number, source
+        HAVING count(*) > 1
+        ORDER BY decision_number, source
+        LIMIT 20
+    ) d;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'cases share a decision_number and source, merge or delete them before migrating: %', duplicates;
+    END IF;
+END
+$$;
+
+CREATE UNIQUE INDEX cases_decision_number_source_key ON cases (decision_number, source);
+DROP INDEX IF EXISTS cases_decision_number_idx;
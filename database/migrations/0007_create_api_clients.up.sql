@@ -0,0 +1,12 @@
+CREATE TABLE api_clients (
+    id         text PRIMARY KEY,
+    name       text NOT NULL,
+    -- sha256 of the salt and the key, the key itself is only shown when issued
+    key_hash   text NOT NULL UNIQUE,
+    key_prefix text NOT NULL,
+    scopes     text[] NOT NULL,
+    expires_at timestamptz,
+    revoked    boolean NOT NULL DEFAULT false,
+    revoked_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
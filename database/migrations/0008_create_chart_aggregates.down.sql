@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS aggregate_refreshes;
+DROP MATERIALIZED VIEW IF EXISTS lkpp_case_stats;
+DROP MATERIALIZED VIEW IF EXISTS case_stats;
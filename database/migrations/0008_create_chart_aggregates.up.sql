@@ -0,0 +1,52 @@
+-- counts of the cases by every filter of the charts but the search query, the
+-- charts of a request without a query are summed from it, see ChartData
+CREATE MATERIALIZED VIEW case_stats AS
+SELECT
+    status,
+    nation,
+    subject_type,
+    case_type,
+    year,
+    count(*) AS total
+FROM
+    cases
+GROUP BY
+    status, nation, subject_type, case_type, year;
+
+-- a unique index lets the view be refreshed concurrently
+CREATE UNIQUE INDEX case_stats_key ON case_stats (status, nation, subject_type, case_type, year);
+
+-- counts of the validated LKPP cases by the fields of their extra data, which
+-- are extracted and cast once per refresh instead of once per chart query,
+-- see LkppChartData
+CREATE MATERIALIZED VIEW lkpp_case_stats AS
+SELECT
+    c.case_date,
+    c.extra_data -> 0 -> 'data' ->> 'province' AS province,
+    (c.extra_data -> 0 -> 'data' ->> 'ceiling')::bigint AS ceiling,
+    c.extra_data -> 0 -> 'data' ->> 'institution_area' AS institution_area,
+    c.extra_data -> 0 -> 'data' ->> 'scenario' AS scenario,
+    c.extra_data -> 0 -> 'data' ->> 'rule' AS rule,
+    count(*) AS total,
+    -- the cases with both punishment dates and the sum of their days
+    count(c.punishment_end - c.punishment_start) AS sanctioned,
+    sum(extract(epoch FROM c.punishment_end::timestamp - c.punishment_start::timestamp) / 86400)::numeric AS sanction_days
+FROM
+    cases c
+WHERE
+    c.extra_data -> 0 ->> 'type' = 'LKPP'
+    AND c.status = 1
+GROUP BY
+    1, 2, 3, 4, 5, 6;
+
+CREATE UNIQUE INDEX lkpp_case_stats_key ON lkpp_case_stats (case_date, province, ceiling, institution_area, scenario, rule);
+
+-- when each view was last refreshed, served as the generated_at of the charts
+CREATE TABLE aggregate_refreshes (
+    name         text PRIMARY KEY,
+    refreshed_at timestamptz NOT NULL
+);
+
+INSERT INTO aggregate_refreshes (name, refreshed_at) VALUES
+    ('case_stats', now()),
+    ('lkpp_case_stats', now());
@@ -0,0 +1 @@
+ALTER TABLE watchlists DROP COLUMN IF EXISTS signing_secret;
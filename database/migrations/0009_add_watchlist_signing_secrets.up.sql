@@ -0,0 +1,8 @@
+-- webhooks are signed with a secret of their watchlist, shown to the owner
+-- when it is set. Existing watchlists get a random one the owner rotates to
+-- learn it.
+ALTER TABLE watchlists ADD COLUMN signing_secret text;
+
+UPDATE watchlists SET signing_secret = 'whsec_' || replace(gen_random_uuid()::text || gen_random_uuid()::text, '-', '');
+
+ALTER TABLE watchlists ALTER COLUMN signing_secret SET NOT NULL;
@@ -0,0 +1,33 @@
+-- 0008 casts the ceiling as is, so one that is not an amount fails every
+-- refresh. The view is created again with a cast that skips those.
+DROP MATERIALIZED VIEW IF EXISTS lkpp_case_stats;
+
+-- counts of the validated LKPP cases by the fields of their extra data, which
+-- are extracted and cast once per refresh instead of once per chart query,
+-- see LkppChartData
+CREATE MATERIALIZED VIEW lkpp_case_stats AS
+SELECT
+    c.case_date,
+    c.extra_data -> 0 -> 'data' ->> 'province' AS province,
+    -- a ceiling that is not an amount is left out of the buckets rather than
+    -- failing the refresh
+    CASE
+        WHEN c.extra_data -> 0 -> 'data' ->> 'ceiling' ~ '^\d{1,18}(\.\d+)?$'
+        THEN trunc((c.extra_data -> 0 -> 'data' ->> 'ceiling')::numeric)::bigint
+    END AS ceiling,
+    c.extra_data -> 0 -> 'data' ->> 'institution_area' AS institution_area,
+    c.extra_data -> 0 -> 'data' ->> 'scenario' AS scenario,
+    c.extra_data -> 0 -> 'data' ->> 'rule' AS rule,
+    count(*) AS total,
+    -- the cases with both punishment dates and the sum of their days
+    count(c.punishment_end - c.punishment_start) AS sanctioned,
+    sum(extract(epoch FROM c.punishment_end::timestamp - c.punishment_start::timestamp) / 86400)::numeric AS sanction_days
+FROM
+    cases c
+WHERE
+    c.extra_data -> 0 ->> 'type' = 'LKPP'
+    AND c.status = 1
+GROUP BY
+    1, 2, 3, 4, 5, 6;
+
+CREATE UNIQUE INDEX lkpp_case_stats_key ON lkpp_case_stats (case_date, province, ceiling, institution_area, scenario, rule);
@@ -0,0 +1 @@
+ALTER TABLE watchlist_case_snapshots DROP COLUMN IF EXISTS updated_at;
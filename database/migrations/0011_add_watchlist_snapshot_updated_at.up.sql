@@ -0,0 +1,8 @@
+-- the updated_at of the case a snapshot was taken of, the watchlist worker
+-- re-scans a window behind its watermark and skips the versions it has seen
+ALTER TABLE watchlist_case_snapshots ADD COLUMN updated_at timestamptz;
+
+UPDATE watchlist_case_snapshots s SET updated_at = c.updated_at
+FROM watchlist_worker_state w, cases c
+WHERE c.id = s.case_id
+AND c.updated_at <= w.last_updated_at;
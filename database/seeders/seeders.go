@@ -0,0 +1,84 @@
+package seeders
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// fixtures hold verdicts, LKPP blacklists and sanctions, as JSON arrays or
+// CSV files with the JSON field names as header.
+//
+//go:embed fixtures/*
+var fixtures embed.FS
+
+// Seed loads every fixture in one transaction and returns how many cases were
+// inserted or brought back to their fixture. Seeding twice writes nothing.
+func Seed(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+	cases, err := loadFixtures()
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+
+	err = pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		written, err = models.UpsertSeedCases(ctx, tx, cases)
+		return err
+	})
+
+	return written, err
+}
+
+func loadFixtures() ([]models.SeedCase, error) {
+	entries, err := fs.ReadDir(fixtures, "fixtures")
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []models.SeedCase
+
+	for _, entry := range entries {
+		content, err := fixtures.ReadFile("fixtures/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		var records []json.RawMessage
+
+		switch path.Ext(entry.Name()) {
+		case ".json":
+			err = json.Unmarshal(content, &records)
+		case ".csv":
+			records, err = models.DecodeCaseCSV(bytes.NewReader(content))
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("fixture %s: %w", entry.Name(), err)
+		}
+
+		for i, record := range records {
+			var c models.SeedCase
+			if err = json.Unmarshal(record, &c); err != nil {
+				return nil, fmt.Errorf("fixture %s record %d: %w", entry.Name(), i+1, err)
+			}
+			cases = append(cases, c)
+		}
+
+		log.Info().Msgf("Loaded %d cases from fixture %s", len(records), entry.Name())
+	}
+
+	return cases, nil
+}
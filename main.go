@@ -3,8 +3,18 @@ package main
 import (
 	"context"
 	bo "lexicon/bo-api/beneficiary_ownership"
+	bo_v1 "lexicon/bo-api/beneficiary_ownership/v1"
+	bo_v1_repositories "lexicon/bo-api/beneficiary_ownership/v1/repositories"
+	bo_v1_services "lexicon/bo-api/beneficiary_ownership/v1/services"
+	"lexicon/bo-api/common/cache"
 	"lexicon/bo-api/common/utils"
+	"lexicon/bo-api/database"
+	"lexicon/bo-api/middlewares"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/golang-module/carbon/v2"
@@ -13,6 +23,7 @@ import (
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
@@ -24,7 +35,15 @@ func main() {
 	cfg := defaultConfig()
 	cfg.loadFromEnv()
 
-	ctx := context.Background()
+	// the context is done on SIGINT or SIGTERM, a second signal kills the
+	// process without waiting for the shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
 	carbon.SetDefault(carbon.Default{
 		Layout:       carbon.ISO8601Layout,
@@ -38,25 +57,125 @@ func main() {
 	pgsqlClient, err := pgxpool.New(ctx, cfg.PgSql.ConnStr())
 
 	if err != nil {
-		log.Error().Err(err).Msg("Unable to connect to PGSQL Database")
+		log.Fatal().Err(err).Msg("Unable to connect to PGSQL Database")
 	}
+	// closed last, once the server and the workers are done with it
 	defer pgsqlClient.Close()
 
 	bo.SetDatabase(pgsqlClient)
 
+	// REDIS
+	// optional, only connected when REDIS_HOST is set
+	var redisClient *redis.Client
+
+	if cfg.Redis.Host != "" {
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr(),
+			Password: cfg.Redis.Password,
+		})
+		defer redisClient.Close()
+	}
+
+	// RESPONSE CACHE
+	var cacheStore cache.Store
+
+	switch cfg.Cache.Store {
+	case "memory":
+		cacheStore = cache.NewMemoryStore(int(cfg.Cache.Size))
+	case "redis":
+		if redisClient == nil {
+			log.Fatal().Msg("CACHE_STORE is redis but REDIS_HOST is not set")
+		}
+		cacheStore = cache.NewRedisStore(redisClient)
+	default:
+		log.Fatal().Str("store", cfg.Cache.Store).Msg("Unknown CACHE_STORE")
+	}
+
+	responses := bo_v1.NewResponseCache(cache.New(cacheStore), cfg.Cache.TTLs())
+
+	// REPOSITORIES AND SERVICES
+	cases := bo_v1_services.NewCaseService(bo_v1_repositories.NewPostgresCaseRepository(pgsqlClient))
+	// every write through the service drops the responses it changes from
+	// the cache of this process. With CACHE_STORE=memory that leaves the cache
+	// of a running server to the TTLs for the writes of the commands
+	cases.OnCaseChange(responses.InvalidateCases)
+
+	// the aggregates of the charts are refreshed by the worker after writes,
+	// the charts cached from the previous ones are dropped then
+	aggregates := bo_v1_services.NewAggregateRefresher()
+	aggregates.OnRefresh(responses.InvalidateCharts)
+	cases.OnCaseChange(func(ctx context.Context, ids []string) {
+		aggregates.Trigger()
+	})
+
+	// SCHEMA CHECK
+	// refuse to serve or to run a command against a database that is not
+	// migrated to this build, but the migrate command that migrates it
+	if len(os.Args) < 2 || os.Args[1] != "migrate" {
+		if err := database.CheckSchema(ctx, pgsqlClient); err != nil {
+			log.Fatal().Err(err).Msg("Database schema check failed")
+		}
+	}
+
+	// SUBCOMMANDS
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, cfg, cases, aggregates, responses, os.Args[1:]); err != nil {
+			log.Fatal().Err(err).Msg("Command failed")
+		}
+		return
+	}
+
+	// RATE LIMITS
+	var rateLimitStore middlewares.RateLimitStore
+
+	switch cfg.RateLimits.Store {
+	case "memory":
+		rateLimitStore = middlewares.NewMemoryRateLimitStore()
+	case "redis":
+		if redisClient == nil {
+			log.Fatal().Msg("RATE_LIMIT_STORE is redis but REDIS_HOST is not set")
+		}
+		rateLimitStore = middlewares.NewRedisRateLimitStore(redisClient)
+	default:
+		log.Fatal().Str("store", cfg.RateLimits.Store).Msg("Unknown RATE_LIMIT_STORE")
+	}
+
+	limiter := middlewares.NewRateLimiter(rateLimitStore, cfg.RateLimits.Limits())
+
 	// init httpClient
 	httpClient := http.Client{
 		Timeout: time.Minute * 5,
 	}
 	utils.SetClient(&httpClient)
 	// INITIATE SERVER
-	server, err := NewLexiconBOServer(cfg)
+	server, err := NewLexiconBOServer(cfg, pgsqlClient, cases, limiter, responses)
 
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to start the server")
 	}
 
+	// BACKGROUND WORKERS
+	// a zero interval disables the watchlist worker and leaves the aggregates
+	// to be refreshed after writes only, both stop with ctx
+	var workers sync.WaitGroup
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		aggregates.Run(ctx, time.Duration(cfg.AggregateInterval)*time.Second)
+	}()
+
+	if cfg.WatchlistInterval > 0 {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			bo_v1_services.RunWatchlistWorker(ctx, time.Duration(cfg.WatchlistInterval)*time.Second)
+		}()
+	}
+
 	server.setupRoute()
-	server.start()
+	server.start(ctx)
+
+	workers.Wait()
 
 }
@@ -1,18 +1,53 @@
 package middlewares
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"errors"
+	"lexicon/bo-api/common/utils"
 	"net/http"
+	"slices"
+
+	"github.com/rs/zerolog/log"
 )
 
-func ApiKey(serverApiKeys string, salt string) func(next http.Handler) http.Handler {
+// ErrUnknownApiKey is returned by an ApiKeyStore for a key that was never
+// issued, is revoked or has expired.
+var ErrUnknownApiKey = errors.New("unknown api key")
+
+// ApiCaller is the client a request was authenticated as.
+type ApiCaller struct {
+	ClientID string
+	Name     string
+	Scopes   []string
+	// Shared is set for the keys of the config, whose consumers are only told
+	// apart by their X-REQUEST-IDENTITY.
+	Shared bool
+}
+
+func (c ApiCaller) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// ApiKeyStore resolves the hash of a key to the client it was issued to.
+type ApiKeyStore interface {
+	ResolveApiKey(ctx context.Context, hashedKey string) (ApiCaller, error)
+}
+
+type apiCallerKey struct{}
+
+// CallerFromContext returns the client authenticated by ApiKey.
+func CallerFromContext(ctx context.Context) (ApiCaller, bool) {
+	caller, ok := ctx.Value(apiCallerKey{}).(ApiCaller)
+	return caller, ok
+}
+
+func ApiKey(store ApiKeyStore, salt string) func(next http.Handler) http.Handler {
 
 	return func(next http.Handler) http.Handler {
 
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-			if len(serverApiKeys) <= 0 || len(salt) <= 0 {
+			if store == nil || len(salt) <= 0 {
 				middlewareError(w, http.StatusInternalServerError, "Internal Server Error", "No API Key Found")
 				return
 			}
@@ -30,20 +65,37 @@ func ApiKey(serverApiKeys string, salt string) func(next http.Handler) http.Hand
 				return
 			}
 
-			hash := sha256.New()
-			hash.Write([]byte(salt + apiKey))
+			caller, err := store.ResolveApiKey(r.Context(), utils.HashApiKey(salt, apiKey))
 
-			hashedKey := hex.EncodeToString(hash.Sum(nil))
-
-			accessedKey := serverApiKeys
+			if errors.Is(err, ErrUnknownApiKey) {
+				middlewareError(w, http.StatusBadRequest, "Bad Request", "Invalid X-API-KEY Header")
+				return
+			}
 
-			if accessedKey == "" {
-				middlewareError(w, http.StatusForbidden, "Forbidden", "Invalid X-API-KEY Header")
+			if err != nil {
+				log.Error().Err(err).Msg("Error resolving api key")
+				middlewareError(w, http.StatusInternalServerError, "Internal Server Error", "Unable to check X-API-KEY")
 				return
 			}
 
-			if accessedKey != hashedKey {
-				middlewareError(w, http.StatusBadRequest, "Bad Request", "Invalid X-API-KEY Header")
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiCallerKey{}, caller)))
+		})
+	}
+
+}
+
+// RequireScope lets through the clients authenticated by ApiKey that were
+// granted scope.
+func RequireScope(scope string) func(next http.Handler) http.Handler {
+
+	return func(next http.Handler) http.Handler {
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			caller, ok := CallerFromContext(r.Context())
+
+			if !ok || !caller.HasScope(scope) {
+				middlewareError(w, http.StatusForbidden, "Forbidden", "X-API-KEY is not granted the "+scope+" scope")
 				return
 			}
 
@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NonceStore remembers the nonces of signed requests to reject replays.
+type NonceStore interface {
+	// Remember stores key for ttl and reports whether it was not already
+	// stored.
+	Remember(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore keeps nonces in the process, so it only protects a
+// single instance.
+type MemoryNonceStore struct {
+	mu        sync.Mutex
+	expiries  map[string]time.Time
+	nextSweep time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{expiries: map[string]time.Time{}}
+}
+
+func (s *MemoryNonceStore) Remember(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// expired nonces are dropped at most once per ttl
+	if now.After(s.nextSweep) {
+		for k, expiry := range s.expiries {
+			if !now.Before(expiry) {
+				delete(s.expiries, k)
+			}
+		}
+		s.nextSweep = now.Add(ttl)
+	}
+
+	if expiry, ok := s.expiries[key]; ok && now.Before(expiry) {
+		return false, nil
+	}
+
+	s.expiries[key] = now.Add(ttl)
+
+	return true, nil
+}
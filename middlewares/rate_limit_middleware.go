@@ -0,0 +1,140 @@
+package middlewares
+
+import (
+	"fmt"
+	"lexicon/bo-api/common/metrics"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// route groups with limits of their own
+const (
+	RateLimitSearch    = "search"
+	RateLimitExport    = "export"
+	RateLimitChatbot   = "chatbot"
+	RateLimitScreening = "screening"
+)
+
+// RateLimiter limits each API client per group of routes, with a token bucket
+// for bursts and a quota per UTC day.
+type RateLimiter struct {
+	store  RateLimitStore
+	limits map[string]RateLimit
+}
+
+// NewRateLimiter limits the groups of limits, a group without a limit or
+// with a zero rate or burst is not limited.
+func NewRateLimiter(store RateLimitStore, limits map[string]RateLimit) *RateLimiter {
+	return &RateLimiter{store: store, limits: limits}
+}
+
+// Limit counts the requests of a group against the client authenticated by
+// ApiKey. Clients of the registry are limited by their id, consumers of the
+// shared keys by their X-REQUEST-IDENTITY as well. The limit closest to run
+// out is sent in the RateLimit-* headers and a refused request gets a 429
+// with Retry-After. The store failing lets requests through.
+func (l *RateLimiter) Limit(group string) func(next http.Handler) http.Handler {
+	return l.LimitCost(group, nil)
+}
+
+// LimitCost is Limit for requests that count as cost requests, such as a
+// batch of names. A request never costs more than the burst or the daily
+// quota of its group, so it passes once the bucket is full.
+func (l *RateLimiter) LimitCost(group string, cost func(r *http.Request) int) func(next http.Handler) http.Handler {
+	limit, ok := l.limits[group]
+
+	return func(next http.Handler) http.Handler {
+
+		if !ok || limit.Rate <= 0 || limit.Burst <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			now := time.Now()
+
+			n := 1
+			if cost != nil {
+				n = min(max(cost(r), 1), limit.Burst)
+				if limit.DailyQuota > 0 {
+					n = min(n, limit.DailyQuota)
+				}
+			}
+
+			state, err := l.store.Take(r.Context(), group+":"+rateLimitKey(r), limit, n, now)
+
+			if err != nil {
+				log.Error().Err(err).Str("group", group).Msg("Error checking rate limit, letting the request through")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			setRateLimitHeaders(w, limit, state, now)
+
+			if state.QuotaExceeded {
+				metrics.RateLimited.WithLabelValues(group, "quota").Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(untilNextDay(now)))
+				middlewareError(w, http.StatusTooManyRequests, "Too Many Requests", "Daily quota of "+group+" requests exceeded")
+				return
+			}
+
+			if !state.Allowed {
+				metrics.RateLimited.WithLabelValues(group, "burst").Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil((float64(n)-state.Tokens)/limit.Rate))))
+				middlewareError(w, http.StatusTooManyRequests, "Too Many Requests", "Rate limit of "+group+" requests exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey names who a request is counted against, the same caller as
+// the callerIdentity of the routers.
+func rateLimitKey(r *http.Request) string {
+	caller, _ := CallerFromContext(r.Context())
+
+	if caller.Shared {
+		return "client:" + caller.ClientID + ":" + r.Header.Get("X-REQUEST-IDENTITY")
+	}
+
+	return "client:" + caller.ClientID
+}
+
+// setRateLimitHeaders sends the bucket, or the quota when fewer requests are
+// left in it, and the policy of both.
+func setRateLimitHeaders(w http.ResponseWriter, limit RateLimit, state RateLimitState, now time.Time) {
+	remaining := int(math.Floor(state.Tokens))
+	size := limit.Burst
+	reset := int(math.Ceil((float64(limit.Burst) - state.Tokens) / limit.Rate))
+
+	policy := fmt.Sprintf("%d;w=%d", limit.Burst, int(math.Ceil(float64(limit.Burst)/limit.Rate)))
+
+	if limit.DailyQuota > 0 {
+		policy += fmt.Sprintf(", %d;w=86400", limit.DailyQuota)
+
+		if left := max(limit.DailyQuota-state.QuotaUsed, 0); left < remaining || state.QuotaExceeded {
+			remaining = left
+			size = limit.DailyQuota
+			reset = untilNextDay(now)
+		}
+	}
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(size))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(reset))
+	w.Header().Set("RateLimit-Policy", policy)
+}
+
+// untilNextDay is the number of seconds before the quotas start over.
+func untilNextDay(now time.Time) int {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+
+	return int(math.Ceil(next.Sub(now).Seconds()))
+}
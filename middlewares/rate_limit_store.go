@@ -0,0 +1,179 @@
+package middlewares
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimit is a token bucket refilled at Rate tokens a second up to Burst,
+// and a number of requests allowed per UTC day, 0 for no quota.
+type RateLimit struct {
+	Rate       float64
+	Burst      int
+	DailyQuota int
+}
+
+// RateLimitState is what is left of a limit after a request.
+type RateLimitState struct {
+	Allowed bool
+	// QuotaExceeded is set when the request was refused for the daily quota.
+	QuotaExceeded bool
+	Tokens        float64
+	QuotaUsed     int
+}
+
+// RateLimitStore keeps the buckets and quotas of the rate limiter.
+type RateLimitStore interface {
+	// Take takes cost tokens from the bucket of key and counts them in its
+	// quota of the day, unless either has less than cost left.
+	Take(ctx context.Context, key string, limit RateLimit, cost int, now time.Time) (RateLimitState, error)
+}
+
+// refill is how many tokens a bucket holds after elapsed, they are only
+// taken by Take.
+func refill(limit RateLimit, tokens float64, elapsed time.Duration) float64 {
+	return math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.Rate)
+}
+
+// quotaDay names the UTC day a quota is counted in.
+func quotaDay(now time.Time) string {
+	return now.UTC().Format("20060102")
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryRateLimitStore keeps the limits in the process, each instance
+// counts on its own.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]tokenBucket
+	quotas    map[string]int
+	day       string
+	nextSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]tokenBucket{}, quotas: map[string]int{}}
+}
+
+// bucketIdleTTL is how long a bucket is kept once unused, any bucket is full
+// again by then with the limits this API runs with.
+const bucketIdleTTL = time.Hour
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, cost int, now time.Time) (RateLimitState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// quotas start over every day, idle buckets are dropped once a while
+	if day := quotaDay(now); day != s.day {
+		s.quotas = map[string]int{}
+		s.day = day
+	}
+
+	if now.After(s.nextSweep) {
+		for k, bucket := range s.buckets {
+			if now.Sub(bucket.updated) > bucketIdleTTL {
+				delete(s.buckets, k)
+			}
+		}
+		s.nextSweep = now.Add(bucketIdleTTL)
+	}
+
+	used := s.quotas[key]
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = tokenBucket{tokens: float64(limit.Burst), updated: now}
+	}
+
+	state := RateLimitState{Tokens: refill(limit, bucket.tokens, now.Sub(bucket.updated)), QuotaUsed: used}
+
+	if limit.DailyQuota > 0 && used+cost > limit.DailyQuota {
+		state.QuotaExceeded = true
+		return state, nil
+	}
+
+	if state.Tokens >= float64(cost) {
+		state.Tokens -= float64(cost)
+		state.Allowed = true
+		state.QuotaUsed += cost
+		s.quotas[key] = state.QuotaUsed
+	}
+
+	s.buckets[key] = tokenBucket{tokens: state.Tokens, updated: now}
+
+	return state, nil
+}
+
+// takeScript runs Take atomically in Redis, with the same arithmetic as the
+// memory store. The bucket expires once it would be full again and the quota
+// a day after the day it counts.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local quota = tonumber(ARGV[4])
+local cost = tonumber(ARGV[5])
+
+local used = tonumber(redis.call('GET', KEYS[2]) or '0')
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated) / 1000 * rate)
+
+if quota > 0 and used + cost > quota then
+	return {0, 1, tostring(tokens), used}
+end
+
+local allowed = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+	used = redis.call('INCRBY', KEYS[2], cost)
+	redis.call('EXPIRE', KEYS[2], 172800)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+
+return {allowed, 0, tostring(tokens), used}
+`)
+
+// RedisRateLimitStore shares the limits between every instance.
+type RedisRateLimitStore struct {
+	client *redis.Client
+}
+
+func NewRedisRateLimitStore(client *redis.Client) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client}
+}
+
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, cost int, now time.Time) (RateLimitState, error) {
+	keys := []string{"ratelimit:bucket:" + key, "ratelimit:quota:" + quotaDay(now) + ":" + key}
+
+	result, err := takeScript.Run(ctx, s.client, keys, limit.Rate, limit.Burst, now.UnixMilli(), limit.DailyQuota, cost).Slice()
+	if err != nil {
+		return RateLimitState{}, err
+	}
+
+	allowed, _ := result[0].(int64)
+	exceeded, _ := result[1].(int64)
+	rawTokens, _ := result[2].(string)
+	used, _ := result[3].(int64)
+
+	tokens, err := strconv.ParseFloat(rawTokens, 64)
+	if err != nil {
+		return RateLimitState{}, err
+	}
+
+	return RateLimitState{Allowed: allowed == 1, QuotaExceeded: exceeded == 1, Tokens: tokens, QuotaUsed: int(used)}, nil
+}
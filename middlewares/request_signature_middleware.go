@@ -1,18 +1,46 @@
 package middlewares
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"bytes"
+	"crypto/hmac"
+	"io"
+	"lexicon/bo-api/common/utils"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
-func RequestSignature(salt string) func(next http.Handler) http.Handler {
+// MaxSignedBodyBytes bounds the body a v2 signature is checked over, it is
+// read whole before the handler runs.
+const MaxSignedBodyBytes = 64 << 20
+
+// SignatureConfig sets up the check of request signatures.
+//
+// Clients pick the scheme with X-SIGNATURE-VERSION. Without it, or with 1,
+// X-REQUEST-SIGNATURE is the v1 sha256 of the salt, the access time and the
+// key. With 2 it is utils.RequestSignatureV2 over the request, X-ACCESS-TIME
+// has to be within MaxSkew of the server clock and X-REQUEST-NONCE can only
+// be used once while the access time is in that window.
+type SignatureConfig struct {
+	Salt string
+	// MaxSkew is how far from the server clock a v2 access time can be.
+	MaxSkew time.Duration
+	// Nonces remembers the nonces of v2 requests.
+	Nonces NonceStore
+	// RequireV2 rejects v1 signatures, once every client has moved over.
+	RequireV2 bool
+}
+
+func RequestSignature(cfg SignatureConfig) func(next http.Handler) http.Handler {
 
 	return func(next http.Handler) http.Handler {
 
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-			if len(salt) <= 0 {
+			if len(cfg.Salt) <= 0 {
 				middlewareError(w, http.StatusInternalServerError, "Internal Server Error", "No Salt Found")
 				return
 			}
@@ -34,13 +62,26 @@ func RequestSignature(salt string) func(next http.Handler) http.Handler {
 				middlewareError(w, http.StatusForbidden, "Forbidden", "Missing X-REQUEST-SIGNATURE")
 				return
 			}
-			hash := sha256.New()
-			hash.Write([]byte(salt + accessTime + apiKey))
 
-			hashedSignature := hex.EncodeToString(hash.Sum(nil))
+			switch r.Header.Get("X-SIGNATURE-VERSION") {
+			case "", "1":
+				if cfg.RequireV2 {
+					middlewareError(w, http.StatusBadRequest, "Bad Request", "X-SIGNATURE-VERSION 2 is required")
+					return
+				}
 
-			if signature != hashedSignature {
-				middlewareError(w, http.StatusBadRequest, "Bad Request", "Invalid X-API-KEY Header")
+				hashedSignature := utils.RequestSignature(cfg.Salt, accessTime, apiKey)
+
+				if signature != hashedSignature {
+					middlewareError(w, http.StatusBadRequest, "Bad Request", "Invalid X-API-KEY Header")
+					return
+				}
+			case "2":
+				if !checkSignatureV2(w, r, cfg, accessTime, apiKey, signature) {
+					return
+				}
+			default:
+				middlewareError(w, http.StatusBadRequest, "Bad Request", "Unsupported X-SIGNATURE-VERSION")
 				return
 			}
 
@@ -49,3 +90,66 @@ func RequestSignature(salt string) func(next http.Handler) http.Handler {
 	}
 
 }
+
+// checkSignatureV2 writes the error response and returns false when the
+// request is not signed with the v2 scheme or is a replay. The body is read
+// to be hashed and put back for the handler.
+func checkSignatureV2(w http.ResponseWriter, r *http.Request, cfg SignatureConfig, accessTime string, apiKey string, signature string) bool {
+	nonce := r.Header.Get("X-REQUEST-NONCE")
+
+	if len(nonce) < 16 || len(nonce) > 128 {
+		middlewareError(w, http.StatusBadRequest, "Bad Request", "X-REQUEST-NONCE must be between 16 and 128 characters")
+		return false
+	}
+
+	access, err := strconv.ParseFloat(accessTime, 64)
+
+	// written so a NaN access time is out of the window too
+	if err != nil || !(math.Abs(float64(time.Now().Unix())-access) <= cfg.MaxSkew.Seconds()) {
+		middlewareError(w, http.StatusBadRequest, "Bad Request", "X-ACCESS-TIME is outside the allowed clock skew")
+		return false
+	}
+
+	var body []byte
+
+	if r.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(r.Body, MaxSignedBodyBytes+1))
+		r.Body.Close()
+
+		if err != nil {
+			middlewareError(w, http.StatusBadRequest, "Bad Request", "Unable to read the body")
+			return false
+		}
+
+		if len(body) > MaxSignedBodyBytes {
+			middlewareError(w, http.StatusRequestEntityTooLarge, "Request Entity Too Large", "Body is too large to be signed")
+			return false
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := utils.RequestSignatureV2(cfg.Salt, apiKey, r.Method, r.URL.EscapedPath(), r.URL.Query(), body, accessTime, nonce)
+
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		middlewareError(w, http.StatusBadRequest, "Bad Request", "Invalid X-REQUEST-SIGNATURE Header")
+		return false
+	}
+
+	// a nonce has to be remembered until its access time leaves the window,
+	// which is at most twice the skew away
+	fresh, err := cfg.Nonces.Remember(r.Context(), utils.HashApiKey(cfg.Salt, apiKey)+":"+nonce, 2*cfg.MaxSkew)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error remembering request nonce")
+		middlewareError(w, http.StatusInternalServerError, "Internal Server Error", "Unable to check X-REQUEST-NONCE")
+		return false
+	}
+
+	if !fresh {
+		middlewareError(w, http.StatusConflict, "Conflict", "X-REQUEST-NONCE was already used")
+		return false
+	}
+
+	return true
+}
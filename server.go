@@ -1,7 +1,15 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	bo_v1 "lexicon/bo-api/beneficiary_ownership/v1"
+	models "lexicon/bo-api/beneficiary_ownership/v1/models"
+	bo_v1_services "lexicon/bo-api/beneficiary_ownership/v1/services"
+	"lexicon/bo-api/common/metrics"
+	"lexicon/bo-api/common/utils"
 	middlewares "lexicon/bo-api/middlewares"
 	"net/http"
 	"strings"
@@ -10,15 +18,27 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/cors"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 )
 
+// readyTimeout bounds each dependency check of the readiness probe.
+const readyTimeout = 3 * time.Second
+
 type LexiconBOServer struct {
-	router *chi.Mux
-	cfg    config
+	router    *chi.Mux
+	metrics   *chi.Mux
+	cfg       config
+	pool      *pgxpool.Pool
+	cases     *bo_v1_services.CaseService
+	limiter   *middlewares.RateLimiter
+	responses *bo_v1.ResponseCache
 }
 
-func NewLexiconBOServer(cfg config) (*LexiconBOServer, error) {
+func NewLexiconBOServer(cfg config, pool *pgxpool.Pool, cases *bo_v1_services.CaseService, limiter *middlewares.RateLimiter, responses *bo_v1.ResponseCache) (*LexiconBOServer, error) {
 
 	r := chi.NewRouter()
 
@@ -33,24 +53,29 @@ func NewLexiconBOServer(cfg config) (*LexiconBOServer, error) {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-API-KEY", "X-ACCESS-TIME", "X-REQUEST-SIGNATURE", "X-API-USER", "X-REQUEST-IDENTITY"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-API-KEY", "X-ACCESS-TIME", "X-REQUEST-SIGNATURE", "X-SIGNATURE-VERSION", "X-REQUEST-NONCE", "X-API-USER", "X-REQUEST-IDENTITY", "If-None-Match"},
+		ExposedHeaders:   []string{"Link", "ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
+	// outside the recoverer, so a panic is counted as the 500 it is served as
+	r.Use(middlewares.Metrics())
 	r.Use(middleware.Recoverer)
 
-	// // Set a timeout value on the request context (ctx), that will signal
-	// // through ctx.Done() that the request has timed out and further
-	// // processing should be stopped.
-	r.Use(middleware.Timeout(2 * time.Minute))
+	// the routers set the timeout of their requests, exports get longer than
+	// the rest
 
 	server := &LexiconBOServer{
-		router: r,
-		cfg:    cfg,
+		router:    r,
+		metrics:   chi.NewRouter(),
+		cfg:       cfg,
+		pool:      pool,
+		cases:     cases,
+		limiter:   limiter,
+		responses: responses,
 	}
 	return server, nil
 
@@ -60,29 +85,168 @@ func (s *LexiconBOServer) setupRoute() {
 	r := s.router
 	cfg := s.cfg
 
-	// Health check endpoint (no auth required)
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"ok"}`))
-	})
+	// Probes (no auth required), /health is kept for existing health checks
+	r.Get("/health", liveHandler)
+	r.Get("/live", liveHandler)
+	r.Get("/ready", s.readyHandler)
+
+	// Metrics (no auth required), served on the internal metrics address only
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.Collectors()...)
+	registry.MustRegister(
+		metrics.NewPoolCollector(s.pool),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	s.metrics.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	// keys are issued per client in the api_clients registry, the shared keys
+	// of the config keep the scopes they always had
+	keys := bo_v1_services.NewApiKeyStore()
+	keys.AddFixedKey("api-key", cfg.BackendApiKey, models.PublicScopes...)
+	keys.AddFixedKey("admin-api-key", cfg.AdminApiKey, models.ScopeAdmin)
+
+	// the nonces of v2 signatures are shared by every route
+	signature := middlewares.SignatureConfig{
+		Salt:      cfg.ServerSalt,
+		MaxSkew:   time.Duration(cfg.SignatureMaxSkew) * time.Second,
+		Nonces:    middlewares.NewMemoryNonceStore(),
+		RequireV2: cfg.SignatureRequireV2,
+	}
 
 	r.Route("/v1", func(r chi.Router) {
 		r.Use(middlewares.AccessTime())
-		r.Use(middlewares.ApiKey(cfg.BackendApiKey, cfg.ServerSalt))
-		r.Use(middlewares.RequestSignature(cfg.ServerSalt))
-		r.Mount("/beneficiary-ownership", bo_v1.Router())
+		r.Use(middlewares.ApiKey(keys, cfg.ServerSalt))
+		r.Use(middlewares.RequestSignature(signature))
+		r.Mount("/beneficiary-ownership", bo_v1.Router(s.cases, s.limiter, s.responses))
+	})
+
+	r.Route("/v1/admin", func(r chi.Router) {
+		r.Use(middlewares.AccessTime())
+		r.Use(middlewares.ApiKey(keys, cfg.ServerSalt))
+		r.Use(middlewares.RequestSignature(signature))
+		r.Mount("/", bo_v1.AdminRouter(s.cases, keys, cfg.ServerSalt))
 	})
 }
 
-func (s *LexiconBOServer) start() {
+// liveHandler reports that the process is up, whatever its dependencies.
+func liveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// readyHandler reports whether the server can take traffic, the database has
+// to answer a ping and the chatbot upstream, when configured, a request. The
+// probe is public, so the errors are only logged.
+func (s *LexiconBOServer) readyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	status := "ok"
+	checks := map[string]string{}
+
+	if err := s.pool.Ping(ctx); err != nil {
+		log.Error().Err(err).Msg("Readiness check of the database failed")
+		status = "unavailable"
+		checks["database"] = "unavailable"
+	} else {
+		checks["database"] = "ok"
+	}
+
+	if s.cfg.ChatbotBaseURL != "" {
+		if err := pingChatbot(ctx, s.cfg.ChatbotBaseURL); err != nil {
+			log.Error().Err(err).Msg("Readiness check of the chatbot failed")
+			status = "unavailable"
+			checks["chatbot"] = "unavailable"
+		} else {
+			checks["chatbot"] = "ok"
+		}
+	}
+
+	code := http.StatusOK
+	if status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{"status": status, "checks": checks})
+}
+
+// pingChatbot succeeds when the chatbot answers, any status below 500 will do.
+func pingChatbot(ctx context.Context, baseURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := utils.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("chatbot answered %s", resp.Status)
+	}
+
+	return nil
+}
+
+// start serves until ctx is done, then stops accepting connections and lets
+// in-flight requests finish within the shutdown timeout. The metrics are
+// served alongside on their own address unless its port is 0.
+func (s *LexiconBOServer) start(ctx context.Context) {
 	r := s.router
 	cfg := s.cfg
 	log.Info().Msg("Starting up server...")
 
-	if err := http.ListenAndServe(cfg.Listen.Addr(), r); err != nil {
-		log.Fatal().Err(err).Msg("Failed to start the server")
+	server := &http.Server{
+		Addr:    cfg.Listen.Addr(),
+		Handler: r,
+	}
+
+	serveErr := make(chan error, 1)
+
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	if cfg.MetricsListen.Port != 0 {
+		metricsServer := &http.Server{
+			Addr:    cfg.MetricsListen.Addr(),
+			Handler: s.metrics,
+		}
+
+		go func() {
+			log.Info().Msgf("Serving metrics on %s", metricsServer.Addr)
+
+			if err := metricsServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("Failed to serve the metrics")
+			}
+		}()
+
+		defer metricsServer.Close()
+	}
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("Failed to start the server")
+		}
 		return
+	case <-ctx.Done():
+	}
+
+	log.Info().Msg("Shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Server did not drain in time, closing remaining connections")
+		server.Close()
 	}
 
 	log.Info().Msg("Server Stopped")